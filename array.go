@@ -36,7 +36,15 @@ func renderInto(slices []reflect.Value) (out []reflect.Value) {
 	return out
 }
 
+// ScanArray scans every remaining row of it, appending a new element to each of the slices `into`
+// points to for each row, and scanning into them as Scan would. If an error occurs, the elements
+// for the row which failed are removed again.
 func ScanArray(it IterableScannable, into ...ScanIntoArray) error {
+	return DefaultMapper.ScanArray(it, into...)
+}
+
+// Mapper.ScanArray is ScanArray, using m to find the fields of the slices' elements and map columns to them.
+func (m *Mapper) ScanArray(it IterableScannable, into ...ScanIntoArray) error {
 	slices, err := getSlices(into)
 	if err != nil { return err }
 
@@ -49,15 +57,16 @@ func ScanArray(it IterableScannable, into ...ScanIntoArray) error {
 	values, types, err := internalNormalizeObjects(zeros, true)
 	if err != nil { return err }
 
-	nfm, err := GetNamedFieldsMakers(types)
+	nfm, err := m.GetNamedFieldsMakers(types)
 	if err != nil { return err }
 
 	named_fields, err := RenderNamedFields(nfm, values)
 	if err != nil { return err }
 
-	smap, err := BuildMap(it, named_fields)
+	smap, conv, err := m.buildMap(it, named_fields)
 	if err != nil { return err }
 
+	vcs, varying := it.(VaryingColumnsScannable)
 	rewind := true
 	defer func() {
 		if !rewind { return }
@@ -77,8 +86,13 @@ func ScanArray(it IterableScannable, into ...ScanIntoArray) error {
 		named_fields, err = RenderNamedFields(nfm, renderInto(slices))
 		if err != nil { return err }
 
+		if varying && vcs.ColumnsChanged() {
+			smap, conv, err = m.buildMap(it, named_fields)
+			if err != nil { return err }
+		}
+
 		// now try to scan
-		err = ScanWithMappedFields(it, smap, named_fields)
+		err = scanMapped(it, smap, conv, named_fields)
 		if err != nil { return err }
 	}
 
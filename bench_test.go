@@ -0,0 +1,298 @@
+package dml
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"database/sql"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// Notes:
+// this file contains benchmarks and allocation regression tests. The benchmarks are run with
+// `go test -run XXX -bench . -benchmem`, and the allocation tests run as part of the normal test
+// suite, so that a change which makes the hot paths allocate more than they used to fails locally.
+// the allocation ceilings below are deliberately exact: if you make something cheaper, lower them.
+
+// benchRows is an in-memory IterableScannable which yields the same row a fixed number of times.
+// it understands just enough destination types to support the structs in this file, and it does
+// no allocation of its own while scanning, so that allocations measured are those made by dml.
+type benchRows struct {
+	columns []string
+	values  []interface{}
+	rows    int
+	cur     int
+}
+
+func (b *benchRows) Scan(out ...interface{}) error {
+	if len(out) != len(b.values) { return fmt.Errorf("expected %d destinations, got %d", len(b.values), len(out)) }
+	for i, v := range out {
+		switch x := v.(type) {
+		case sql.Scanner:
+			if err := x.Scan(b.values[i]); err != nil { return err }
+		case *int64:
+			*x = b.values[i].(int64)
+		case *string:
+			*x = b.values[i].(string)
+		case *bool:
+			*x = b.values[i].(bool)
+		case *float64:
+			*x = b.values[i].(float64)
+		default:
+			return fmt.Errorf("bad type: %T", v)
+		}
+	}
+	return nil
+}
+
+func (b *benchRows) ColumnNames() ([]string, error) { return b.columns, nil }
+func (b *benchRows) Next() bool                     { b.cur++; return b.cur <= b.rows }
+func (b *benchRows) Err() error                     { return nil }
+func (b *benchRows) Close() error                   { return nil }
+func (b *benchRows) reset()                         { b.cur = 0 }
+
+// BenchSmall is representative of a lookup table row.
+type BenchSmall struct {
+	Id   int64  `dml:"id"`
+	Name string `dml:"name"`
+	Flag bool   `dml:"flag"`
+}
+
+type BenchAudit struct {
+	CreatedBy int64  `dml:"created_by"`
+	UpdatedBy int64  `dml:"updated_by"`
+	Comment   string `dml:"comment"`
+}
+
+// BenchMedium is representative of a typical entity, with an embedded struct.
+type BenchMedium struct {
+	BenchAudit
+
+	Id       int64   `dml:"id"`
+	Name     string  `dml:"name"`
+	Email    string  `dml:"email"`
+	Active   bool    `dml:"active"`
+	Score    float64 `dml:"score"`
+	ParentId int64   `dml:"parent_id"`
+	Kind     string  `dml:"kind"`
+	Status   string  `dml:"status"`
+	Rank     int64   `dml:"rank"`
+}
+
+// BenchWide is representative of a reporting row with many columns.
+type BenchWide struct {
+	F00, F01, F02, F03, F04, F05, F06, F07, F08, F09 int64
+	F10, F11, F12, F13, F14, F15, F16, F17, F18, F19 int64
+	F20, F21, F22, F23, F24, F25, F26, F27, F28, F29 int64
+	F30, F31, F32, F33, F34, F35, F36, F37, F38, F39 int64
+}
+
+// BenchWide can't reasonably be written out with tags by hand, so it describes itself.
+func (w *BenchWide) NoDefaults() {}
+func (w *BenchWide) GetFields() (NamedFields, error) {
+	fields := []*int64{
+		&w.F00, &w.F01, &w.F02, &w.F03, &w.F04, &w.F05, &w.F06, &w.F07, &w.F08, &w.F09,
+		&w.F10, &w.F11, &w.F12, &w.F13, &w.F14, &w.F15, &w.F16, &w.F17, &w.F18, &w.F19,
+		&w.F20, &w.F21, &w.F22, &w.F23, &w.F24, &w.F25, &w.F26, &w.F27, &w.F28, &w.F29,
+		&w.F30, &w.F31, &w.F32, &w.F33, &w.F34, &w.F35, &w.F36, &w.F37, &w.F38, &w.F39,
+	}
+	var n NamedFields
+	for i, f := range fields { n.Push(benchWideNames[i], f) }
+	return n, nil
+}
+
+var benchWideNames = func() (out []string) {
+	for i := 0; i < 40; i++ { out = append(out, "f" + strconv.Itoa(i)) }
+	return out
+}()
+
+func benchSmallRows(n int) *benchRows {
+	return &benchRows{
+		columns: []string{"flag", "name", "id"},
+		values:  []interface{}{true, "name", int64(1)},
+		rows:    n,
+	}
+}
+
+func benchMediumRows(n int) *benchRows {
+	return &benchRows{
+		columns: []string{"id", "name", "email", "active", "score", "parent_id", "kind", "status", "rank", "created_by", "updated_by", "comment"},
+		values:  []interface{}{int64(1), "name", "e@mail", true, 1.5, int64(2), "kind", "status", int64(3), int64(4), int64(5), "comment"},
+		rows:    n,
+	}
+}
+
+func benchWideRows(n int) *benchRows {
+	b := &benchRows{rows: n}
+	// reverse order, so that the mapping is not trivially the identity
+	for i := len(benchWideNames) - 1; i >= 0; i-- {
+		b.columns = append(b.columns, benchWideNames[i])
+		b.values = append(b.values, int64(i))
+	}
+	return b
+}
+
+// benchNamedFields builds a NamedFields of `fields` names matched against `columns` columns,
+// with the columns in reverse order so that the linear search does real work.
+func benchNamedFields(fields, columns int) (*benchRows, NamedFields) {
+	var n NamedFields
+	b := &benchRows{}
+	for i := 0; i < fields; i++ { n.Push("column_" + strconv.Itoa(i), nil) }
+	for i := columns - 1; i >= 0; i-- { b.columns = append(b.columns, "column_" + strconv.Itoa(i)) }
+	return b, n
+}
+
+// BenchmarkBuildMap measures both of BuildMap's strategies across the sizes where they cross over.
+func BenchmarkBuildMap(b *testing.B) {
+	for _, size := range []int{3, 8, 12, 16, 24, 40, 100} {
+		rows, fields := benchNamedFields(size, size)
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := BuildMap(rows, fields); err != nil { b.Fatal(err) }
+			}
+		})
+	}
+}
+
+func BenchmarkGetFieldsFrom(b *testing.B) {
+	var small BenchSmall
+	var medium BenchMedium
+	var wide BenchWide
+	cases := map[string]ScanInto{"small": &small, "medium": &medium, "wide": &wide}
+
+	for k, v := range cases {
+		b.Run(k, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := GetFieldsFrom(v); err != nil { b.Fatal(err) }
+			}
+		})
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	var small BenchSmall
+	var medium BenchMedium
+	var wide BenchWide
+	cases := map[string]struct{
+		rows *benchRows
+		into ScanInto
+	}{
+		"small":  {benchSmallRows(1), &small},
+		"medium": {benchMediumRows(1), &medium},
+		"wide":   {benchWideRows(1), &wide},
+	}
+
+	for k, v := range cases {
+		b.Run(k, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := Scan(v.rows, v.into); err != nil { b.Fatal(err) }
+			}
+		})
+	}
+}
+
+func BenchmarkScanWithMap(b *testing.B) {
+	var medium BenchMedium
+	rows := benchMediumRows(1)
+	fields, _ := GetFieldsFrom(&medium)
+	smap, _ := BuildMap(rows, fields)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := ScanWithMap(rows, smap, &medium); err != nil { b.Fatal(err) }
+	}
+}
+
+// BenchmarkScanArray measures whole result sets of several sizes, so that the fixed per-call cost
+// (building the map and rendering the zero values) can be told apart from the per-row cost.
+func BenchmarkScanArray(b *testing.B) {
+	for _, n := range []int{1, 100, 1000} {
+		b.Run("small/" + strconv.Itoa(n), func(b *testing.B) {
+			rows := benchSmallRows(n)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rows.reset()
+				var out []BenchSmall
+				if err := ScanArray(rows, &out); err != nil { b.Fatal(err) }
+			}
+		})
+		b.Run("medium/" + strconv.Itoa(n), func(b *testing.B) {
+			rows := benchMediumRows(n)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rows.reset()
+				var out []BenchMedium
+				if err := ScanArray(rows, &out); err != nil { b.Fatal(err) }
+			}
+		})
+	}
+}
+
+// BenchmarkScanArraySqlmock runs ScanArray over a real *sql.Rows, to put dml's overhead in the context
+// of the cost of database/sql itself.
+func BenchmarkScanArraySqlmock(b *testing.B) {
+	db, mock, err := sqlmock.New()
+	if err != nil { b.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT id, name, flag FROM table"
+	for i := 0; i < b.N; i++ {
+		rows := sqlmock.NewRows([]string{"id", "name", "flag"})
+		for j := 0; j < 100; j++ { rows.AddRow(int64(j), "name", true) }
+		mock.ExpectQuery(query).WillReturnRows(rows)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := X(db.Query(query))
+		if err != nil { b.Fatal(err) }
+		var out []BenchSmall
+		if err := ScanArray(rows, &out); err != nil { b.Fatal(err) }
+		rows.Close()
+	}
+}
+
+// Test_Allocs guards against allocation regressions in the hot paths. The ceilings are the numbers
+// of allocations the current implementation makes; see the notes at the top of this file.
+func Test_Allocs(t *testing.T) {
+	if testing.Short() { t.Skip("skipping allocation tests in short mode") }
+
+	var small BenchSmall
+	var medium BenchMedium
+	smallRows := benchSmallRows(1)
+	mediumRows := benchMediumRows(1)
+	mediumFields, _ := GetFieldsFrom(&medium)
+	mediumMap, _ := BuildMap(mediumRows, mediumFields)
+	linearRows, linearFields := benchNamedFields(8, 8)
+	hashedRows, hashedFields := benchNamedFields(40, 40)
+
+	// warm up the field cache, which allocates on first use.
+	if err := Scan(smallRows, &small); err != nil { t.Fatal(err) }
+	if err := Scan(mediumRows, &medium); err != nil { t.Fatal(err) }
+
+	testcases := map[string]struct{
+		max float64
+		f func()
+	}{
+		"BuildMap-linear":   {1, func() { BuildMap(linearRows, linearFields) }},
+		"BuildMap-hashed":   {48, func() { BuildMap(hashedRows, hashedFields) }},
+		"GetFieldsFrom":     {8, func() { GetFieldsFrom(&medium) }},
+		"Scan-small":        {10, func() { Scan(smallRows, &small) }},
+		"Scan-medium":       {10, func() { Scan(mediumRows, &medium) }},
+		"ScanWithMap":       {9, func() { ScanWithMap(mediumRows, mediumMap, &medium) }},
+		"ScanArray-small":   {51, func() { smallRows.reset(); smallRows.rows = 5; var out []BenchSmall; ScanArray(smallRows, &out); smallRows.rows = 1 }},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			if allocs := testing.AllocsPerRun(100, v.f); allocs > v.max {
+				t.Errorf("Allocation regression (%s): got %v allocations per run, expected at most %v", k, allocs, v.max)
+			}
+		})
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"sync"
+	"strings"
 )
 
 // sqlScannerType is a helper variable for buildFieldCacheEntryForType.
@@ -14,13 +14,18 @@ var sqlScannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
 var getFieldsType = reflect.TypeOf((*GetFields)(nil)).Elem()
 var noDefaultsType = reflect.TypeOf((*NoDefaults)(nil)).Elem()
 
-// GetFieldsFrom populates fieldsCache with an appropriate entry if necessary, and then uses the cached value
+// GetFieldsFrom populates the field cache with an appropriate entry if necessary, and then uses the cached value
 // to build a suitable NamedFields object for the given input.
 func GetFieldsFrom(into ...ScanInto) (output NamedFields, err error) {
+	return DefaultMapper.GetFieldsFrom(into...)
+}
+
+// Mapper.GetFieldsFrom is GetFieldsFrom, using m's tags and cache.
+func (m *Mapper) GetFieldsFrom(into ...ScanInto) (output NamedFields, err error) {
 	values, types, err := NormalizeObjects(into)
 	if err != nil { return NamedFields{}, err }
 
-	nfm, err := GetNamedFieldsMakers(types)
+	nfm, err := m.GetNamedFieldsMakers(types)
 	if err != nil { return NamedFields{}, err }
 
 	return RenderNamedFields(nfm, values)
@@ -76,8 +81,13 @@ func internalNormalizeObjects(into []ScanInto, ignoreUnsettable bool) (out_vals
 // Take the types of several objects and return an array of objects capable of marshalling
 // each of them into NamedFields objects.
 func GetNamedFieldsMakers(types []reflect.Type) (output []NamedFieldsMaker, err error) {
+	return DefaultMapper.GetNamedFieldsMakers(types)
+}
+
+// Mapper.GetNamedFieldsMakers is GetNamedFieldsMakers, using m's tags and cache.
+func (m *Mapper) GetNamedFieldsMakers(types []reflect.Type) (output []NamedFieldsMaker, err error) {
 	for _, t := range types {
-		cached, err := getFieldCachesFor(t)
+		cached, err := m.getFieldCachesFor(t)
 		if err != nil { return nil, err }
 		output = append(output, cached)
 	}
@@ -96,25 +106,56 @@ func RenderNamedFields(nfm []NamedFieldsMaker, values []reflect.Value) (output N
 	return output, nil
 }
 
-// buildFieldCacheEntryForType takes a reflect.Type with kind == struct, and parses the struct
-// definition, looking for `dml` field tags and using them to construct an instance-agnostic
+// Mapper.buildFieldCacheEntryForType takes a reflect.Type with kind == struct, and parses the struct
+// definition, looking for field tags with m's keys and using them to construct an instance-agnostic
 // roadmap of the struct's fields which can later be used to efficiently build a NamedFields
 // object for an instance of that type.
 //
-// Anonymous nested structs are traversed into as well (named ones are not, as a row from
-// an SQL query is an inherently one dimensional structure). Unexported fields are ignored.
-func buildFieldCacheEntryForType(t reflect.Type, path []int) (output fieldCacheEntry, err error) {
+// Anonymous nested structs, and pointers to them, are traversed into as well (named ones are not,
+// as a row from an SQL query is an inherently one dimensional structure). Unexported fields are ignored.
+// A struct which embeds a pointer to itself, directly or through other embedded structs, is an error.
+func (m *Mapper) buildFieldCacheEntryForType(t reflect.Type, path []int) (output fieldCacheEntry, err error) {
 	defer func() { if r := recover(); r != nil { err = fmt.Errorf("%v", r) } }()
+	return m.buildFieldCacheEntry(t, path, nil)
+}
+
+// Mapper.buildFieldCacheEntry does the work of buildFieldCacheEntryForType. outer holds the types
+// of the structs enclosing t, from the outermost, so that embedding cycles can be detected.
+func (m *Mapper) buildFieldCacheEntry(t reflect.Type, path []int, outer []reflect.Type) (output fieldCacheEntry, err error) {
 	if t.Kind() == reflect.Invalid { return fieldCacheEntry{}, errors.New("nil value is not acceptable") }
 	if t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(noDefaultsType) { return fieldCacheEntry{}, nil }
 
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		if db_field, ok := field.Tag.Lookup("dml"); len(field.PkgPath) == 0 && ok {
-			output.Push(db_field, path, i, field.Type.Implements(sqlScannerType))
+		// unexported fields are never scanned into, so their tags aren't examined, although embedded
+		// structs are still searched for exported fields.
+		exported := len(field.PkgPath) == 0
+		if !exported && !field.Anonymous { continue }
+		var tag FieldTag
+		var ok bool
+		if exported {
+			var tag_err error
+			tag, ok, tag_err = m.parseTag(field.Tag)
+			if tag_err != nil { return fieldCacheEntry{}, fmt.Errorf("error examining field %s: %w", field.Name, tag_err) }
+		}
+		if ok {
+			var def reflect.Value
+			if tag.HasDefault {
+				def, err = parseDefault(field.Type, tag.Default)
+				if err != nil { return fieldCacheEntry{}, fmt.Errorf("error examining field %s: %w", field.Name, err) }
+			}
+			output.Push(tag.Name, path, i, field.Type.Implements(sqlScannerType), def, tag.Required, tag.wrapper(m))
 		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
-			sub_cache, sub_error := buildFieldCacheEntryForType(field.Type, append(path, i))
+			sub_cache, sub_error := m.buildFieldCacheEntry(field.Type, append(path, i), append(outer, t))
+			if sub_error != nil { return fieldCacheEntry{}, fmt.Errorf("error examining field %s: %w", field.Name, sub_error) }
+			output.Append(sub_cache)
+		} else if field.Anonymous && field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+			for _, o := range append(outer, t) {
+				if o == field.Type.Elem() { return fieldCacheEntry{}, fmt.Errorf("error examining field %s: %v embeds itself", field.Name, o) }
+			}
+			sub_cache, sub_error := m.buildFieldCacheEntry(field.Type.Elem(), append(path, i), append(outer, t))
 			if sub_error != nil { return fieldCacheEntry{}, fmt.Errorf("error examining field %s: %w", field.Name, sub_error) }
+			for j := range sub_cache.Indirect { sub_cache.Indirect[j] = true }
 			output.Append(sub_cache)
 		}
 	}
@@ -122,9 +163,109 @@ func buildFieldCacheEntryForType(t reflect.Type, path []int) (output fieldCacheE
 	return output, nil
 }
 
-// getCachedFieldsFor fetches a NamedFieldsMaker for this type, which is either a cached representation
+// FieldTag is the parsed form of a `dml` field tag, which consists of a column name optionally
+// followed by comma separated options:
+//     `dml:"retries,default=3"`
+// The column name may list aliases, separated by |, as in `dml:"username|user_name"`. See BuildMap.
+// default=VALUE stores VALUE into the field when its column is NULL or missing from the result
+// set. VALUE is parsed according to the kind of the field, and can't contain a comma.
+// required makes it an error for the field's column to be missing from the result set, and so
+// can't be combined with default.
+// json decodes the column into the field as JSON (see JSON), array parses it as a Postgres array
+// (see Array), hstore parses it as a Postgres hstore (see Hstore), and composite parses it as a
+// Postgres composite (see Composite), optionally with its attributes declared in order, separated
+// by semicolons: `composite=id;name`. Only one of these can be used at a time, and not with default.
+type FieldTag struct {
+	Name       string
+	Default    string
+	HasDefault bool
+	Required   bool
+	JSON       bool
+	Array      bool
+	Hstore     bool
+	Composite  bool
+	Attributes string
+}
+
+// FieldTag.Aliases returns the column names the field can be populated from, in order of
+// precedence. The first is the one the field is written to.
+func (t FieldTag) Aliases() []string {
+	return strings.Split(t.Name, "|")
+}
+
+// FieldTag.AttributeList returns the attributes declared by the composite option, or nil.
+func (t FieldTag) AttributeList() []string {
+	if t.Attributes == "" { return nil }
+	return strings.Split(t.Attributes, ";")
+}
+
+// FieldTag.wrapper returns a function which wraps a pointer to a field with this tag in the
+// sql.Scanner its options call for, or nil if the field is scanned into directly. Composites are
+// parsed using m.
+func (t FieldTag) wrapper(m *Mapper) func(interface{}) interface{} {
+	switch {
+	case t.JSON:
+		return func(f interface{}) interface{} { return JSON(f) }
+	case t.Array:
+		return func(f interface{}) interface{} { return Array(f) }
+	case t.Hstore:
+		return func(f interface{}) interface{} { return Hstore(f) }
+	case t.Composite:
+		attributes := t.AttributeList()
+		return func(f interface{}) interface{} { return m.Composite(f, attributes...) }
+	}
+	return nil
+}
+
+// ParseTag parses the `dml` tag out of a struct field's tags, reporting false if there isn't one.
+// It is exported so that tools which examine structs without reflection (such as dmlgen) can
+// interpret tags exactly the way the runtime does.
+func ParseTag(tag reflect.StructTag) (FieldTag, bool, error) {
+	return parseTagValue(tag.Lookup("dml"))
+}
+
+// parseTagValue parses the value of a tag, as returned by reflect.StructTag.Lookup.
+func parseTagValue(value string, ok bool) (FieldTag, bool, error) {
+	if !ok { return FieldTag{}, false, nil }
+
+	parts := strings.Split(value, ",")
+	output := FieldTag{Name: parts[0]}
+	for _, option := range parts[1:] {
+		kv := strings.SplitN(option, "=", 2)
+		switch {
+		case kv[0] == "default" && len(kv) == 2:
+			output.Default, output.HasDefault = kv[1], true
+		case option == "required":
+			output.Required = true
+		case option == "json":
+			output.JSON = true
+		case option == "array":
+			output.Array = true
+		case option == "hstore":
+			output.Hstore = true
+		case option == "composite":
+			output.Composite = true
+		case kv[0] == "composite" && len(kv) == 2 && kv[1] != "":
+			output.Composite, output.Attributes = true, kv[1]
+		default:
+			return FieldTag{}, true, fmt.Errorf("unknown dml tag option %q", option)
+		}
+	}
+
+	var exclusive []string
+	for _, o := range []struct{ name string; set bool }{{"default", output.HasDefault}, {"json", output.JSON}, {"array", output.Array}, {"hstore", output.Hstore}, {"composite", output.Composite}} {
+		if o.set { exclusive = append(exclusive, o.name) }
+	}
+	if len(exclusive) > 1 { return FieldTag{}, true, fmt.Errorf("dml tag options %s can't be combined", strings.Join(exclusive, " and ")) }
+	// a default already stands in for a missing column, so requiring the column would contradict it.
+	if output.Required && output.HasDefault { return FieldTag{}, true, errors.New("dml tag options required and default can't be combined") }
+
+	return output, true, nil
+}
+
+// Mapper.getFieldCachesFor fetches a NamedFieldsMaker for this type, which is either a cached representation
 // of the relevant fields of the type, or a passthru shim which handles GetFields implementors.
-func getFieldCachesFor(t reflect.Type) (output NamedFieldsMaker, err error) {
+func (m *Mapper) getFieldCachesFor(t reflect.Type) (output NamedFieldsMaker, err error) {
 	// unwrap pointer/interface indirections
 	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
 		t = t.Elem()
@@ -135,22 +276,19 @@ func getFieldCachesFor(t reflect.Type) (output NamedFieldsMaker, err error) {
 		return fieldCacheEntry{}, errors.New("nested object is not struct")
 	}
 
-	// lookup from, and if necessary populate, fieldsCache for this type
-	fieldsCacheLock.RLock()
-	cached, ok := fieldsCache[t]
-	fieldsCacheLock.RUnlock()
+	// lookup from, and if necessary populate, m's cache for this type. only the first caller to
+	// miss builds the entry; any others arriving meanwhile wait for it, and later callers don't block.
+	slot, ok := m.cache.Load(t)
 	if !ok {
-		fieldsCacheLock.Lock()
-		cached, ok = fieldsCache[t]
-		if !ok {
-			cached, err = buildFieldCacheEntryForType(t, nil)
-			if err != nil { return fieldCacheEntry{}, err }
-			fieldsCache[t] = cached
-		}
-		fieldsCacheLock.Unlock()
+		fresh := &fieldsCacheSlot{done: make(chan struct{})}
+		slot, ok = m.cache.LoadOrStore(t, fresh)
+		if !ok { fresh.build(m, t) }
 	}
 
-	return cached, nil
+	s := slot.(*fieldsCacheSlot)
+	<-s.done
+	if s.err != nil { return fieldCacheEntry{}, s.err }
+	return s.entry, nil
 }
 
 // NamedFieldsMaker provides a consistent interface for storing the cached field info about a type.
@@ -172,17 +310,28 @@ func (n namedFieldsFromGetFields) NamedFields(v reflect.Value) (NamedFields, err
 }
 
 // fieldCacheEntry is an internal type representing an instance-agnostic set of fields.
+// Defaults holds the parsed default value of each field, or the zero Value if it has none,
+// Wrappers holds the function which wraps each field for scanning, or nil if it has none, and
+// Indirect records whether the path to each field passes through an embedded pointer.
 type fieldCacheEntry struct {
 	Names []string
 	Fields [][]int
 	IsScanner []bool
+	Defaults []reflect.Value
+	Required []bool
+	Wrappers []func(interface{}) interface{}
+	Indirect []bool
 }
 
 // fieldCacheEntry.Push adds a new field into a fieldCacheEntry.
-func (c *fieldCacheEntry) Push(name string, prefix []int, value int, scanner bool) *fieldCacheEntry {
+func (c *fieldCacheEntry) Push(name string, prefix []int, value int, scanner bool, def reflect.Value, required bool, wrapper func(interface{}) interface{}) *fieldCacheEntry {
 	c.Names = append(c.Names, name)
 	c.Fields = append(c.Fields, append(prefix[:len(prefix):len(prefix)], value))
 	c.IsScanner = append(c.IsScanner, scanner)
+	c.Defaults = append(c.Defaults, def)
+	c.Required = append(c.Required, required)
+	c.Wrappers = append(c.Wrappers, wrapper)
+	c.Indirect = append(c.Indirect, false)
 	return c
 }
 
@@ -191,6 +340,10 @@ func (c *fieldCacheEntry) Append(other fieldCacheEntry) *fieldCacheEntry {
 	c.Names = append(c.Names, other.Names...)
 	c.Fields = append(c.Fields, other.Fields...)
 	c.IsScanner = append(c.IsScanner, other.IsScanner...)
+	c.Defaults = append(c.Defaults, other.Defaults...)
+	c.Required = append(c.Required, other.Required...)
+	c.Wrappers = append(c.Wrappers, other.Wrappers...)
+	c.Indirect = append(c.Indirect, other.Indirect...)
 	return c
 }
 
@@ -210,11 +363,20 @@ func (c fieldCacheEntry) NamedFields(v reflect.Value) (n NamedFields, err error)
 	}
 
 	for i := range c.Names {
-		f := v.FieldByIndex(c.Fields[i])
-		if !c.IsScanner[i] {
-			f = f.Addr()
+		var field interface{}
+		if !c.Indirect[i] {
+			field = c.render(i, v.FieldByIndex(c.Fields[i]))
+		} else if f, _ := fieldByIndex(v, c.Fields[i], false); f.IsValid() {
+			field = c.render(i, f)
+		} else {
+			field = &lazyField{v: v, entry: c, i: i}
+		}
+
+		if c.Required[i] {
+			n.PushRequired(c.Names[i], field, v.Type().String())
+		} else {
+			n.Push(c.Names[i], field)
 		}
-		n.Push(c.Names[i], f.Interface())
 	}
 	
 	n.Append(gf)
@@ -222,8 +384,96 @@ func (c fieldCacheEntry) NamedFields(v reflect.Value) (n NamedFields, err error)
 	return n, nil
 }
 
-// fieldCaches is an internal cache of field representations, optimized for rendering to NamedFields objects.
-var fieldsCache = make(map[reflect.Type]fieldCacheEntry)
+// fieldCacheEntry.render returns what is scanned into for the i'th field, given the field itself.
+func (c *fieldCacheEntry) render(i int, f reflect.Value) interface{} {
+	switch {
+	case c.Wrappers[i] != nil:
+		return c.Wrappers[i](f.Addr().Interface())
+	case c.Defaults[i].IsValid():
+		return &defaultScanner{field: f.Addr().Interface(), value: c.Defaults[i]}
+	case !c.IsScanner[i]:
+		return f.Addr().Interface()
+	}
+	return f.Interface()
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, except that nil embedded pointers along the path are
+// allocated if alloc is set, and otherwise result in the zero Value rather than a panic.
+func fieldByIndex(v reflect.Value, path []int, alloc bool) (reflect.Value, error) {
+	for i, x := range path {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc { return reflect.Value{}, nil }
+				if !v.CanSet() { return reflect.Value{}, fmt.Errorf("cannot allocate embedded %v, as it is unexported", v.Type()) }
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// lazyField stands in for a field which is reached through a nil embedded pointer. The pointers
+// along the way are only allocated if the field is scanned into, so that embedded structs none of
+// whose columns are present stay nil.
+type lazyField struct {
+	v     reflect.Value
+	entry fieldCacheEntry
+	i     int
+}
 
-// fieldsCacheLock is a mutex which protects fieldsCache from concurrent read/write.
-var fieldsCacheLock sync.RWMutex
+// IndirectField is implemented by what dml scans into in place of a field reached through a nil
+// embedded pointer. Sources which store values according to the type of the field they go into,
+// such as csvsource, call Field to find it: it allocates the embedded pointers along the way, and
+// returns what would have been scanned into had they not been nil.
+type IndirectField interface {
+	sql.Scanner
+	Field() (interface{}, error)
+}
+
+// lazyField.Field allocates the path to the field, and returns what is scanned into for it.
+func (l *lazyField) Field() (interface{}, error) {
+	f, err := fieldByIndex(l.v, l.entry.Fields[l.i], true)
+	if err != nil { return nil, err }
+	return l.entry.render(l.i, f), nil
+}
+
+// lazyField.placeholder returns what Field would for a struct of the field's own, so that its type
+// can be examined without allocating the path to the real one.
+func (l *lazyField) placeholder() interface{} {
+	t := l.v.Type().FieldByIndex(l.entry.Fields[l.i]).Type
+	return l.entry.render(l.i, reflect.New(t).Elem())
+}
+
+// lazyField.Scan allocates the path to the field, and then scans into it as usual.
+func (l *lazyField) Scan(src interface{}) error {
+	field, err := l.Field()
+	if err != nil { return err }
+	if scanner, ok := field.(sql.Scanner); ok { return scanner.Scan(src) }
+	return ConvertAssign(field, src)
+}
+
+// lazyField.defaults returns the defaultScanner for the field, if it has a default and the path to
+// it has been allocated since the field was rendered (because another of its columns was scanned).
+func (l *lazyField) defaults() (*defaultScanner, bool) {
+	if !l.entry.Defaults[l.i].IsValid() { return nil, false }
+	f, _ := fieldByIndex(l.v, l.entry.Fields[l.i], false)
+	if !f.IsValid() { return nil, false }
+	d, ok := l.entry.render(l.i, f).(*defaultScanner)
+	return d, ok
+}
+
+// fieldsCacheSlot holds the cached fields of a type, or the error building them, once done is closed.
+type fieldsCacheSlot struct {
+	done  chan struct{}
+	entry fieldCacheEntry
+	err   error
+}
+
+// fieldsCacheSlot.build populates the slot for t, as examined by m, and then releases anyone waiting for it.
+// buildFieldCacheEntryForType recovers from panics itself, returning them as errors, so the slot is always populated.
+func (s *fieldsCacheSlot) build(m *Mapper, t reflect.Type) {
+	defer close(s.done)
+	s.entry, s.err = m.buildFieldCacheEntryForType(t, nil)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Notes:
+// the golden files in testdata can be regenerated with
+// `go run . -output testdata/basic/basic_dml.go.golden testdata/basic/basic.go` (and likewise
+// with `-placeholder ?` for basic_dml_question.go.golden)
+// and should be reviewed by hand when they change.
+
+func Test_Generate(t *testing.T) {
+	testcases := map[string]struct{
+		opts Options
+		golden string
+		err string
+	}{
+		"file":         {Options{File: "basic.go"}, "basic_dml.go.golden", ""},
+		"question":     {Options{File: "basic.go", Placeholder: "?"}, "basic_dml_question.go.golden", ""},
+		"explicit":     {Options{Types: []string{"User"}}, "", ""},
+		"missing":      {Options{Types: []string{"Nope"}}, "", "not found"},
+		"has-methods":  {Options{Types: []string{"Custom"}}, "", "already has"},
+		"not-tagged":   {Options{Types: []string{"NotTagged"}}, "", "no dml tagged fields"},
+		"not-struct":   {Options{Types: []string{"Level"}}, "", "not a struct"},
+		"bad-key":      {Options{Types: []string{"BadKey"}}, "", "key column"},
+		"bad-default":  {Options{Types: []string{"BadDefault"}}, "", "bad default value"},
+		"indirect":     {Options{Types: []string{"Revision"}}, "", "field Stamp.CreatedBy: columns reached through embedded pointers"},
+		"cycle":        {Options{Types: []string{"Node"}}, "", "field Node: basic.Node embeds itself"},
+		"placeholder":  {Options{File: "basic.go", Placeholder: ":"}, "", "placeholder"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			src, err := Generate(filepath.Join("testdata", "basic"), v.opts)
+			if v.err == "" && err != nil { t.Fatalf("Unexpected return value (Generate): got %v, expected nil", err) }
+			if v.err != "" && (err == nil || !strings.Contains(err.Error(), v.err)) { t.Errorf("Unexpected return value (Generate): got %v, expected '%s' error", err, v.err) }
+			if v.golden == "" { return }
+
+			golden, err := ioutil.ReadFile(filepath.Join("testdata", "basic", v.golden))
+			if err != nil { t.Fatalf("couldn't read golden file: %v", err) }
+			if !bytes.Equal(src, golden) { t.Errorf("Unexpected output (Generate): got\n%s\nexpected\n%s", src, golden) }
+		})
+	}
+}
+
+func Test_GenerateEmbedded(t *testing.T) {
+	testcases := map[string]struct{
+		types []string
+		err string
+	}{
+		"base":   {[]string{"Base"}, "type Draft embeds Base, whose generated methods would hide Draft's own tagged fields"},
+		"post":   {[]string{"Base", "Post"}, "type Draft embeds Post"},
+		"all":    {[]string{"Base", "Post", "Draft"}, ""},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			_, err := Generate(filepath.Join("testdata", "embedded"), Options{Types: v.types})
+			if v.err == "" && err != nil { t.Errorf("Unexpected return value (Generate): got %v, expected nil", err) }
+			if v.err != "" && (err == nil || !strings.Contains(err.Error(), v.err)) { t.Errorf("Unexpected return value (Generate): got %v, expected '%s' error", err, v.err) }
+		})
+	}
+}
+
+// Test_GenerateCompiles type checks the generated code together with the package it was generated
+// for, which catches mistakes in field expressions (such as taking the address of a scanner).
+func Test_GenerateCompiles(t *testing.T) {
+	dir := filepath.Join("testdata", "basic")
+	src, err := Generate(dir, Options{File: "basic.go"})
+	if err != nil { t.Fatalf("Unexpected return value (Generate): got %v, expected nil", err) }
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range []string{"basic.go", "basic_dml.go"} {
+		var f *ast.File
+		if name == "basic.go" {
+			f, err = parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		} else {
+			f, err = parser.ParseFile(fset, name, src, 0)
+		}
+		if err != nil { t.Fatalf("couldn't parse %s: %v", name, err) }
+		files = append(files, f)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("basic", fset, files, nil); err != nil { t.Errorf("Generated code does not compile: %v", err) }
+}
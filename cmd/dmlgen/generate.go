@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/thewug/dml"
+	"github.com/thewug/dml/internal/structcols"
+)
+
+// generatedHeader marks files written by dmlgen. Such files are ignored when loading a package,
+// so that regenerating doesn't trip over the methods generated last time.
+const generatedHeader = "// Code generated by dmlgen. DO NOT EDIT."
+
+// column is a single entry in a generated GetFields. name is the column it is written to, and tag
+// the (possibly aliased) name it is read from. def is the go expression for the field's
+// default value, if it has one, and wrap is a format for the call to the dml function the field's
+// address is passed through for both reading and writing, if any.
+type column struct {
+	name     string
+	tag      string
+	expr     string
+	scanner  bool
+	def      string
+	required bool
+	wrap     string
+}
+
+// target is a struct for which code will be generated. owner is its name as reflect would print
+// it, which dml uses to describe missing required columns.
+type target struct {
+	name    string
+	owner   string
+	columns []column
+	table   string
+	keys    []string
+}
+
+// Options controls what Generate produces.
+type Options struct {
+	// File restricts the default selection of types to those declared in the named file.
+	File string
+	// Types, if not empty, is exactly the list of types to generate for.
+	Types []string
+	// Placeholder is the bind parameter style used in generated SQL: "$" for $1, $2, ... or "?".
+	Placeholder string
+}
+
+// generatedMethods are the methods dmlgen writes for each struct, which therefore must not exist already.
+var generatedMethods = []string{"GetFields", "NoDefaults", "Columns", "Values", "Table"}
+
+// loadPackage parses and type checks the non-test, non-generated go files in dir. Type errors
+// are tolerated, since the package may well not compile until the generated code exists.
+func loadPackage(dir string) (*token.FileSet, []*ast.File, *types.Package, error) {
+	fset := token.NewFileSet()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil { return nil, nil, nil, err }
+
+	var list []*ast.File
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") { continue }
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil { return nil, nil, nil, err }
+		if len(f.Comments) != 0 && f.Comments[0].Pos() < f.Package && f.Comments[0].List[0].Text == generatedHeader { continue }
+		list = append(list, f)
+	}
+	if len(list) == 0 { return nil, nil, nil, fmt.Errorf("no go files in %s", dir) }
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(list[0].Name.Name, fset, list, nil)
+	return fset, list, pkg, nil
+}
+
+// existingMethod returns the name of the first of generatedMethods which *t already has, if any.
+func existingMethod(t types.Type) string {
+	for _, m := range generatedMethods {
+		if structcols.HasMethod(t, m) { return m }
+	}
+	return ""
+}
+
+// basicTypes maps the kinds of basic go types to their reflect equivalents, so that default values
+// can be parsed by dml itself.
+var basicTypes = map[types.BasicKind]reflect.Type{
+	types.Bool:    reflect.TypeOf(false),
+	types.Int:     reflect.TypeOf(int(0)),
+	types.Int8:    reflect.TypeOf(int8(0)),
+	types.Int16:   reflect.TypeOf(int16(0)),
+	types.Int32:   reflect.TypeOf(int32(0)),
+	types.Int64:   reflect.TypeOf(int64(0)),
+	types.Uint:    reflect.TypeOf(uint(0)),
+	types.Uint8:   reflect.TypeOf(uint8(0)),
+	types.Uint16:  reflect.TypeOf(uint16(0)),
+	types.Uint32:  reflect.TypeOf(uint32(0)),
+	types.Uint64:  reflect.TypeOf(uint64(0)),
+	types.Float32: reflect.TypeOf(float32(0)),
+	types.Float64: reflect.TypeOf(float64(0)),
+	types.String:  reflect.TypeOf(""),
+}
+
+// defaultLiteral renders the default value of c as a go expression of c's underlying basic type,
+// which dml.Default converts to the field's own type when it is applied.
+func defaultLiteral(c structcols.Column) (string, error) {
+	t := c.Type.Underlying()
+	if p, ok := t.(*types.Pointer); ok { t = p.Elem().Underlying() }
+	basic, ok := t.(*types.Basic)
+	if !ok || basicTypes[basic.Kind()] == nil { return "", fmt.Errorf("default values are not supported for fields of type %v", c.Type) }
+
+	v, err := dml.ParseDefault(basicTypes[basic.Kind()], c.Tag.Default)
+	if err != nil { return "", err }
+	return fmt.Sprintf("%s(%#v)", basic.Name(), v), nil
+}
+
+// wrapperCall returns a format for the call which wraps the address of a field with the given tag,
+// the same way the tag's options make dml wrap it at runtime, or "" if it isn't wrapped.
+func wrapperCall(tag dml.FieldTag) string {
+	switch {
+	case tag.JSON:
+		return "dml.JSON(&%s)"
+	case tag.Array:
+		return "dml.Array(&%s)"
+	case tag.Hstore:
+		return "dml.Hstore(&%s)"
+	case tag.Composite:
+		call := "dml.Composite(&%s"
+		for _, a := range tag.AttributeList() { call += ", " + strings.ReplaceAll(strconv.Quote(a), "%", "%%") }
+		return call + ")"
+	}
+	return ""
+}
+
+// errIndirect is returned by columnsOf for structs with columns under embedded pointers, which
+// generated code can't take the addresses of without allocating the embedded structs first.
+var errIndirect = errors.New("columns reached through embedded pointers are not supported")
+
+// columnsOf converts the columns of s into the field expressions used in generated code.
+func columnsOf(s *types.Struct) (output []column, err error) {
+	columns, err := structcols.Columns(s)
+	if err != nil { return nil, err }
+	for _, c := range columns {
+		if c.Indirect { return nil, fmt.Errorf("field %s: %w", strings.Join(c.Path, "."), errIndirect) }
+		col := column{
+			name:     c.Tag.Aliases()[0],
+			tag:      c.Tag.Name,
+			expr:     "x." + strings.Join(c.Path, "."),
+			scanner:  c.Scanner,
+			required: c.Tag.Required,
+		}
+		col.wrap = wrapperCall(c.Tag)
+		if c.Tag.HasDefault {
+			col.def, err = defaultLiteral(c)
+			if err != nil { return nil, fmt.Errorf("field %s: %w", strings.Join(c.Path, "."), err) }
+		}
+		output = append(output, col)
+	}
+	return output, nil
+}
+
+// directives finds the `//dml:name value` comments in the documentation of each type declared in files.
+func directives(files []*ast.File) map[string]map[string]string {
+	output := make(map[string]map[string]string)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE { continue }
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				found := make(map[string]string)
+				for _, doc := range []*ast.CommentGroup{gen.Doc, ts.Doc} {
+					if doc == nil { continue }
+					for _, c := range doc.List {
+						if !strings.HasPrefix(c.Text, "//dml:") { continue }
+						kv := strings.SplitN(strings.TrimPrefix(c.Text, "//dml:"), " ", 2)
+						if len(kv) == 2 { found[kv[0]] = strings.TrimSpace(kv[1]) }
+					}
+				}
+				output[ts.Name.Name] = found
+			}
+		}
+	}
+
+	return output
+}
+
+// snakeCase converts a go identifier such as UserHTTPLog into user_http_log.
+func snakeCase(name string) string {
+	var out []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (!unicode.IsUpper(runes[i-1]) || i + 1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			out = append(out, '_')
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
+
+// findTargets picks out the structs to generate code for. If names is empty, every struct declared
+// in file which has any columns and none of the generated methods of its own is selected.
+func findTargets(pkg *types.Package, fset *token.FileSet, files []*ast.File, file string, names []string) ([]target, error) {
+	explicit := len(names) != 0
+	dirs := directives(files)
+	if !explicit {
+		for _, n := range pkg.Scope().Names() {
+			obj := pkg.Scope().Lookup(n)
+			if _, ok := obj.(*types.TypeName); !ok { continue }
+			if file != "" && filepath.Base(fset.Position(obj.Pos()).Filename) != file { continue }
+			names = append(names, n)
+		}
+	}
+
+	var output []target
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		obj, ok := pkg.Scope().Lookup(n).(*types.TypeName)
+		if !ok {
+			if explicit { return nil, fmt.Errorf("type %s not found", n) }
+			continue
+		}
+		s, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok {
+			if explicit { return nil, fmt.Errorf("type %s is not a struct", n) }
+			continue
+		}
+		if m := existingMethod(obj.Type()); m != "" {
+			if explicit { return nil, fmt.Errorf("type %s already has a %s method", n, m) }
+			continue
+		}
+
+		columns, err := columnsOf(s)
+		if errors.Is(err, errIndirect) && !explicit { continue }
+		if err != nil { return nil, fmt.Errorf("type %s: %w", n, err) }
+		if len(columns) == 0 {
+			if explicit { return nil, fmt.Errorf("type %s has no dml tagged fields", n) }
+			continue
+		}
+
+		t := target{name: n, owner: pkg.Name() + "." + n, columns: columns, table: dirs[n]["table"]}
+		if t.table == "" { t.table = snakeCase(n) }
+		if key := dirs[n]["key"]; key != "" {
+			for _, k := range strings.Split(key, ",") {
+				k = strings.TrimSpace(k)
+				if !t.hasColumn(k) { return nil, fmt.Errorf("type %s: key column %s is not one of its columns", n, k) }
+				t.keys = append(t.keys, k)
+			}
+		}
+		output = append(output, t)
+	}
+
+	return output, nil
+}
+
+// checkEmbedders returns an error if a struct in pkg which isn't being generated for embeds one
+// which is, and has tagged fields of its own. The generated GetFields and NoDefaults would be
+// promoted into it, so dml would use them, and never see its own fields.
+func checkEmbedders(pkg *types.Package, targets []target) error {
+	generated := make(map[types.Type]string)
+	for _, t := range targets { generated[pkg.Scope().Lookup(t.name).Type()] = t.name }
+
+	for _, n := range pkg.Scope().Names() {
+		obj, ok := pkg.Scope().Lookup(n).(*types.TypeName)
+		if !ok { continue }
+		if _, ok := generated[obj.Type()]; ok { continue }
+		s, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok || structcols.HasMethod(obj.Type(), "GetFields") || structcols.HasMethod(obj.Type(), "NoDefaults") { continue }
+
+		embedded, tagged := embedsGenerated(s, generated, nil)
+		if embedded != "" && tagged { return fmt.Errorf("type %s embeds %s, whose generated methods would hide %s's own tagged fields from dml; generate for %s too", n, embedded, n, n) }
+	}
+	return nil
+}
+
+// embedsGenerated returns the name of a generated type which s embeds, directly or through other
+// embedded structs, and reports whether s has tagged fields which aren't reached through one.
+// outer holds the structs enclosing s, so that embedding cycles are only followed once.
+func embedsGenerated(s *types.Struct, generated map[types.Type]string, outer []*types.Struct) (embedded string, tagged bool) {
+	for i := 0; i < s.NumFields(); i++ {
+		field := s.Field(i)
+		if _, ok, _ := dml.ParseTag(reflect.StructTag(s.Tag(i))); ok && field.Exported() {
+			tagged = true
+			continue
+		}
+		if !field.Anonymous() { continue }
+
+		t := field.Type()
+		if p, ok := t.(*types.Pointer); ok { t = p.Elem() }
+		if name, ok := generated[t]; ok {
+			embedded = name
+			continue
+		}
+		sub, ok := t.Underlying().(*types.Struct)
+		if !ok || structcols.HasMethod(t, "NoDefaults") { continue }
+		cycle := false
+		for _, o := range append(outer, s) { cycle = cycle || o == sub }
+		if cycle { continue }
+		sub_embedded, sub_tagged := embedsGenerated(sub, generated, append(outer, s))
+		if sub_embedded != "" { embedded = sub_embedded }
+		tagged = tagged || sub_tagged
+	}
+	return embedded, tagged
+}
+
+// hasColumn reports whether t has a column with the given name.
+func (t target) hasColumn(name string) bool {
+	for _, c := range t.columns {
+		if c.name == name { return true }
+	}
+	return false
+}
+
+// isKey reports whether the named column is one of t's keys.
+func (t target) isKey(name string) bool {
+	for _, k := range t.keys {
+		if k == name { return true }
+	}
+	return false
+}
+
+// unique reports whether each of t's column names appears only once, which is necessary for them
+// to make sense as the column list of an INSERT or UPDATE.
+func (t target) unique() bool {
+	seen := make(map[string]bool)
+	for _, c := range t.columns {
+		if seen[c.name] { return false }
+		seen[c.name] = true
+	}
+	return true
+}
+
+// Generate returns the source of a file containing generated code for the package in dir.
+func Generate(dir string, opts Options) ([]byte, error) {
+	if opts.Placeholder == "" { opts.Placeholder = "$" }
+	if opts.Placeholder != "$" && opts.Placeholder != "?" { return nil, fmt.Errorf("unknown placeholder style %q", opts.Placeholder) }
+
+	fset, files, pkg, err := loadPackage(dir)
+	if err != nil { return nil, err }
+
+	targets, err := findTargets(pkg, fset, files, opts.File, opts.Types)
+	if err != nil { return nil, err }
+	if len(targets) == 0 { return nil, errors.New("nothing to generate") }
+	if err := checkEmbedders(pkg, targets); err != nil { return nil, err }
+
+	var body bytes.Buffer
+	usesSql := false
+	for _, t := range targets {
+		writeReadSide(&body, t)
+		usesSql = writeWriteSide(&body, t, opts.Placeholder) || usesSql
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n\npackage %s\n\nimport (\n", generatedHeader, pkg.Name())
+	if usesSql { fmt.Fprintf(&buf, "\"database/sql\"\n\n") }
+	fmt.Fprintf(&buf, "\"github.com/thewug/dml\"\n)\n")
+	buf.Write(body.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil { return nil, fmt.Errorf("formatting generated code: %w", err) }
+	return src, nil
+}
+
+// writeReadSide writes the column list constant, NoDefaults and GetFields.
+func writeReadSide(buf *bytes.Buffer, t target) {
+	names := make([]string, len(t.columns))
+	quoted := make([]string, len(t.columns))
+	fields := make([]string, len(t.columns))
+	var required []string
+	for i, c := range t.columns {
+		if c.required { required = append(required, fmt.Sprintf("{Index: %d, Owner: %s}", i, strconv.Quote(t.owner))) }
+		names[i] = c.name
+		quoted[i] = strconv.Quote(c.tag)
+		fields[i] = c.expr
+		if c.wrap != "" {
+			fields[i] = fmt.Sprintf(c.wrap, c.expr)
+		} else if c.def != "" {
+			fields[i] = fmt.Sprintf("dml.Default(&%s, %s)", c.expr, c.def)
+		} else if !c.scanner {
+			fields[i] = "&" + c.expr
+		}
+	}
+
+	fmt.Fprintf(buf, "\n// %sColumns lists the columns %s is populated from, in field order.\n", t.name, t.name)
+	fmt.Fprintf(buf, "const %sColumns = %s\n", t.name, strconv.Quote(strings.Join(names, ", ")))
+	fmt.Fprintf(buf, "\n// NoDefaults tells dml not to build fields for %s from its tags, since GetFields covers them.\n", t.name)
+	fmt.Fprintf(buf, "func (x *%s) NoDefaults() {}\n", t.name)
+	fmt.Fprintf(buf, "\n// GetFields lists the fields of %s in the same order dml would find them from its tags.\n", t.name)
+	fmt.Fprintf(buf, "func (x *%s) GetFields() (dml.NamedFields, error) {\n", t.name)
+	fmt.Fprintf(buf, "\treturn dml.NamedFields{\n")
+	fmt.Fprintf(buf, "\t\tNames: []string{%s},\n", strings.Join(quoted, ", "))
+	fmt.Fprintf(buf, "\t\tFields: []interface{}{%s},\n", strings.Join(fields, ", "))
+	if len(required) != 0 { fmt.Fprintf(buf, "\t\tRequired: []dml.RequiredField{%s},\n", strings.Join(required, ", ")) }
+	fmt.Fprintf(buf, "\t}, nil\n}\n")
+}
+
+// placeholder renders the i'th (zero based) bind parameter in the given style.
+func placeholder(style string, i int) string {
+	if style == "?" { return "?" }
+	return "$" + strconv.Itoa(i + 1)
+}
+
+// writeWriteSide writes Table, Columns, Values, and (if the column names are unique) the Insert
+// and UpdateByKey functions. UpdateByKey is only written if the struct declares a key. It reports
+// whether anything it wrote refers to database/sql.
+func writeWriteSide(buf *bytes.Buffer, t target, style string) bool {
+	quoted := make([]string, len(t.columns))
+	values := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		quoted[i] = strconv.Quote(c.name)
+		values[i] = c.expr
+		if c.wrap != "" { values[i] = fmt.Sprintf(c.wrap, c.expr) }
+	}
+
+	fmt.Fprintf(buf, "\n// Table returns the name of the table %s is stored in.\n", t.name)
+	fmt.Fprintf(buf, "func (x *%s) Table() string { return %s }\n", t.name, strconv.Quote(t.table))
+	fmt.Fprintf(buf, "\n// Columns returns the columns of %s, in the same order as Values.\n", t.name)
+	fmt.Fprintf(buf, "func (x *%s) Columns() []string {\n\treturn []string{%s}\n}\n", t.name, strings.Join(quoted, ", "))
+	fmt.Fprintf(buf, "\n// Values returns the values of the fields of %s, in the same order as Columns.\n", t.name)
+	fmt.Fprintf(buf, "func (x *%s) Values() []interface{} {\n\treturn []interface{}{%s}\n}\n", t.name, strings.Join(values, ", "))
+
+	if !t.unique() { return false }
+
+	names := make([]string, len(t.columns))
+	params := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = c.name
+		params[i] = placeholder(style, i)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.table, strings.Join(names, ", "), strings.Join(params, ", "))
+	fmt.Fprintf(buf, "\n// Insert%s inserts x into %s.\n", t.name, t.table)
+	fmt.Fprintf(buf, "func Insert%s(db dml.Execer, x *%s) (sql.Result, error) {\n", t.name, t.name)
+	fmt.Fprintf(buf, "\treturn db.Exec(%s, x.Values()...)\n}\n", strconv.Quote(insert))
+
+	if len(t.keys) == 0 { return true }
+
+	var sets, wheres, args []string
+	for i, c := range t.columns {
+		if t.isKey(c.name) { continue }
+		sets = append(sets, c.name + " = " + placeholder(style, len(args)))
+		args = append(args, values[i])
+	}
+	for _, k := range t.keys {
+		for i, c := range t.columns {
+			if c.name != k { continue }
+			wheres = append(wheres, c.name + " = " + placeholder(style, len(args)))
+			args = append(args, values[i])
+		}
+	}
+	if len(sets) == 0 { return true }
+
+	update := fmt.Sprintf("UPDATE %s SET %s WHERE %s", t.table, strings.Join(sets, ", "), strings.Join(wheres, " AND "))
+	fmt.Fprintf(buf, "\n// Update%sByKey updates the row of %s whose %s matches x.\n", t.name, t.table, strings.Join(t.keys, ", "))
+	fmt.Fprintf(buf, "func Update%sByKey(db dml.Execer, x *%s) (sql.Result, error) {\n", t.name, t.name)
+	fmt.Fprintf(buf, "\treturn db.Exec(%s, %s)\n}\n", strconv.Quote(update), strings.Join(args, ", "))
+	return true
+}
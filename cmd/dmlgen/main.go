@@ -0,0 +1,84 @@
+// dmlgen generates reflection-free GetFields and NoDefaults implementations for structs with
+// `dml` field tags, along with a constant listing each struct's columns. The generated code
+// produces exactly the same NamedFields that dml would otherwise build from the tags using
+// reflection, so it can be dropped in (or removed) without changing the behavior of any scan.
+//
+// For the write side, it also generates Table, Columns and Values methods, which agree with
+// GetFields column for column, and InsertX and UpdateXByKey functions built on top of them.
+// The table name defaults to the snake_cased type name, and the key used by UpdateXByKey is
+// declared with directives in the type's doc comment:
+//     //dml:table users
+//     //dml:key id
+// Without a key, no UpdateXByKey is generated. Structs which map several fields to the same
+// column name get no InsertX or UpdateXByKey, since such a column list isn't valid SQL.
+//
+// usage, from a file in the package containing the structs:
+//     //go:generate dmlgen -type Foo,Bar
+//
+// with no -type flag, every struct declared in the file which has at least one `dml` tag is
+// generated for. Structs which already have a GetFields or NoDefaults method are skipped in that
+// case, and are an error if named explicitly. The output is written to <file>_dml.go.
+//
+// Since the generated methods are promoted through embedding, a generated struct which is embedded
+// in another tagged struct would hide that struct's tags from dml, so this is an error unless code
+// is generated for the outer struct too.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; default is every tagged struct in the file")
+	output    = flag.String("output", "", "output file name; default is <file>_dml.go, or dml_gen.go for a directory")
+	bindStyle = flag.String("placeholder", "$", "bind parameter style for generated SQL: $ or ?")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: dmlgen [flags] [file.go | directory]\n")
+	fmt.Fprintf(os.Stderr, "with no arguments, $GOFILE (as set by go generate) is used.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dmlgen: ")
+	flag.Usage = usage
+	flag.Parse()
+
+	target := os.Getenv("GOFILE")
+	if flag.NArg() == 1 {
+		target = flag.Arg(0)
+	} else if flag.NArg() > 1 || target == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir, file := target, ""
+	if strings.HasSuffix(target, ".go") {
+		dir, file = filepath.Dir(target), filepath.Base(target)
+	}
+
+	opts := Options{File: file, Placeholder: *bindStyle}
+	if *typeNames != "" { opts.Types = strings.Split(*typeNames, ",") }
+
+	src, err := Generate(dir, opts)
+	if err != nil { log.Fatal(err) }
+
+	out := *output
+	if out == "" {
+		if file != "" {
+			out = filepath.Join(dir, strings.TrimSuffix(file, ".go") + "_dml.go")
+		} else {
+			out = filepath.Join(dir, "dml_gen.go")
+		}
+	}
+
+	if err := ioutil.WriteFile(out, src, 0644); err != nil { log.Fatal(err) }
+}
@@ -0,0 +1,5 @@
+package basic
+
+type BadDefault struct {
+	Count int64 `dml:"count,default=many"`
+}
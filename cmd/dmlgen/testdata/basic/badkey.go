@@ -0,0 +1,6 @@
+package basic
+
+//dml:key nope
+type BadKey struct {
+	Id int64 `dml:"id"`
+}
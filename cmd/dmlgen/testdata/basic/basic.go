@@ -0,0 +1,59 @@
+package basic
+
+import (
+	"database/sql"
+)
+
+type Audit struct {
+	CreatedBy int64 `dml:"created_by"`
+	UpdatedBy int64 `dml:"updated_by"`
+}
+
+type Scanned struct{}
+
+func (s *Scanned) Scan(interface{}) error { return nil }
+
+// User is the main test subject.
+//
+//dml:table app_users
+//dml:key id
+type User struct {
+	Audit
+
+	Id       int64              `dml:"id,required"`
+	Name     string             `dml:"name,default=anonymous"`
+	Retries  *Level             `dml:"retries,default=3"`
+	Nickname sql.NullString     `dml:"nickname|nick"`
+	Thing    *Scanned           `dml:"thing"`
+	Settings map[string]int     `dml:"settings,json"`
+	Tags     []string           `dml:"tags,array"`
+	Labels   map[string]*string `dml:"labels,hstore"`
+	Home     Address            `dml:"home,composite=street;city"`
+	Untagged string
+	private  string `dml:"private"`
+}
+
+// UserHTTPLog has a duplicated column, so it gets no insert or update.
+type UserHTTPLog struct {
+	User   int64 `dml:"id"`
+	Target int64 `dml:"id"`
+}
+
+type Custom struct {
+	Id int64 `dml:"id"`
+}
+
+func (c *Custom) GetFields() (NamedFields, error) { return NamedFields{}, nil }
+
+type NamedFields struct{}
+
+type NotTagged struct {
+	Id int64
+}
+
+type Level int
+
+type Address struct {
+	Street string `dml:"street"`
+	City   string `dml:"city"`
+}
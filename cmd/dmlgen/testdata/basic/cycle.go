@@ -0,0 +1,6 @@
+package basic
+
+type Node struct {
+	*Node
+	X int `dml:"x"`
+}
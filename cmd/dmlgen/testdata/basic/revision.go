@@ -0,0 +1,14 @@
+package basic
+
+// Stamp is declared apart from basic.go, so that it isn't generated for with it; if it were, its
+// methods would be promoted into Revision.
+type Stamp struct {
+	CreatedBy int64 `dml:"created_by"`
+}
+
+// Revision embeds a pointer, so it is skipped unless asked for.
+type Revision struct {
+	*Stamp
+
+	Note string `dml:"note"`
+}
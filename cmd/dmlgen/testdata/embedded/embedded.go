@@ -0,0 +1,21 @@
+package embedded
+
+type Base struct {
+	Id int64 `dml:"id"`
+}
+
+type Post struct {
+	Base
+
+	Title string `dml:"title"`
+}
+
+type Draft struct {
+	Post
+
+	Notes string `dml:"notes"`
+}
+
+type Wrapper struct {
+	Draft
+}
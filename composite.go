@@ -0,0 +1,253 @@
+package dml
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CompositeField wraps a pointer to a struct (or a pointer to a pointer to a struct) whose column
+// holds a Postgres composite value, such as a ROW(...) returned by a function. It is both a
+// sql.Scanner, which parses the composite's text representation into the struct, and a
+// driver.Valuer, which formats the struct as a composite literal for writing.
+type CompositeField struct {
+	field      interface{}
+	attributes []string
+	mapper     *Mapper
+}
+
+// Composite wraps field so that its column is parsed as a Postgres composite literal, such as
+// `(1,"a b",,t)`, when scanned. The composite's attributes are matched with the struct's fields
+// (as dml finds them from tags or GetFields) in order, or, if attributes are given, by matching
+// the attributes, in order, with the fields of the same names; attributes without a field are
+// ignored. Attributes are stored as database/sql would store a column holding their text (see
+// ConvertAssign), except that nested structs are parsed as composites, slices as arrays, and
+// time.Time from the formats Postgres uses. NULL stores the zero value (or a nil pointer). The
+// result can also be passed to Exec, where it formats the struct as a composite literal. This is
+// what the `composite` tag option does, and can be used in GetFields implementations to the same effect.
+// The struct's fields are found using DefaultMapper.
+func Composite(field interface{}, attributes ...string) *CompositeField {
+	return DefaultMapper.Composite(field, attributes...)
+}
+
+// Mapper.Composite is Composite, using m to find the fields of the struct, and of any structs nested in it.
+func (m *Mapper) Composite(field interface{}, attributes ...string) *CompositeField {
+	return &CompositeField{field: field, attributes: attributes, mapper: m}
+}
+
+// CompositeField.Scan parses src, which must be NULL, a string or a []byte, into the struct.
+func (c *CompositeField) Scan(src interface{}) error {
+	dv := reflect.ValueOf(c.field).Elem()
+	if src == nil {
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	}
+	text, ok := literalText(src)
+	if !ok { return fmt.Errorf("cannot parse composite from %T", src) }
+
+	t := dv.Type()
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+	fresh := reflect.New(t)
+	if err := c.mapper.decodeComposite(fresh, text, c.attributes); err != nil { return err }
+	if dv.Kind() == reflect.Ptr {
+		dv.Set(fresh)
+	} else {
+		dv.Set(fresh.Elem())
+	}
+	return nil
+}
+
+// CompositeField.Value formats the struct as a composite literal. A nil pointer is written as NULL.
+func (c *CompositeField) Value() (driver.Value, error) {
+	dv := reflect.ValueOf(c.field).Elem()
+	if dv.Kind() == reflect.Ptr {
+		if dv.IsNil() { return nil, nil }
+		dv = dv.Elem()
+	}
+	buf, err := c.mapper.appendComposite(nil, dv, c.attributes)
+	if err != nil { return nil, err }
+	return string(buf), nil
+}
+
+// literalText returns the text of a value which should hold a literal.
+func literalText(src interface{}) (string, bool) {
+	switch s := src.(type) {
+	case []byte:
+		return string(s), true
+	case string:
+		return s, true
+	}
+	return "", false
+}
+
+// parseComposite parses a Postgres composite literal into its attributes. An attribute with no
+// characters at all is NULL, while "" is an empty string.
+func parseComposite(s string) ([]arrayElem, error) {
+	p := &literalParser{s: s}
+	p.skipSpace()
+	if p.pos >= len(s) || s[p.pos] != '(' { return nil, p.errorf("expected '('") }
+	p.pos++
+
+	var output []arrayElem
+	for {
+		var b strings.Builder
+		quoted := false
+		for p.pos < len(s) && s[p.pos] != ',' && s[p.pos] != ')' {
+			if s[p.pos] == '"' {
+				text, err := p.quoted(true)
+				if err != nil { return nil, err }
+				b.WriteString(text)
+				quoted = true
+				continue
+			}
+			if s[p.pos] == '\\' && p.pos + 1 < len(s) { p.pos++ }
+			b.WriteByte(s[p.pos])
+			p.pos++
+		}
+		if p.pos >= len(s) { return nil, p.errorf("unterminated composite") }
+
+		output = append(output, arrayElem{value: b.String(), null: !quoted && b.Len() == 0})
+		p.pos++
+		if s[p.pos - 1] == ')' { break }
+	}
+
+	p.skipSpace()
+	if p.pos != len(s) { return nil, p.errorf("unexpected trailing characters") }
+	return output, nil
+}
+
+// Mapper.decodeComposite parses text into the struct pv points to, whose fields m finds.
+func (m *Mapper) decodeComposite(pv reflect.Value, text string, attributes []string) error {
+	attrs, err := parseComposite(text)
+	if err != nil { return err }
+	fields, err := m.GetFieldsFrom(pv.Interface())
+	if err != nil { return err }
+
+	if attributes == nil {
+		if len(attrs) != len(fields.Fields) { return fmt.Errorf("composite has %d attributes, but %v has %d fields", len(attrs), pv.Type().Elem(), len(fields.Fields)) }
+		for i, a := range attrs {
+			if err := m.assignAttribute(fields.Fields[i], a); err != nil { return fmt.Errorf("attribute %d (%s): %w", i, fields.Names[i], err) }
+		}
+		return nil
+	}
+
+	if len(attrs) != len(attributes) { return fmt.Errorf("composite has %d attributes, but %d were declared", len(attrs), len(attributes)) }
+	for i, a := range attrs {
+		idx := indexOf(fields.Names, attributes[i])
+		if idx < 0 { continue }
+		if err := m.assignAttribute(fields.Fields[idx], a); err != nil { return fmt.Errorf("attribute %d (%s): %w", i, attributes[i], err) }
+	}
+	return nil
+}
+
+// indexOf returns the index of the first of names which has the given alias, or -1.
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if hasAlias(n, name) { return i }
+	}
+	return -1
+}
+
+// isCompositeStruct reports whether t is a struct which attributes are parsed into as a nested composite.
+func isCompositeStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(sqlScannerType)
+}
+
+// Mapper.assignAttribute stores a single composite attribute into field, as found in a NamedFields.
+// Nested composites are parsed using m.
+func (m *Mapper) assignAttribute(field interface{}, a arrayElem) error {
+	var src interface{}
+	if !a.null { src = a.value }
+	if scanner, ok := field.(sql.Scanner); ok { return scanner.Scan(src) }
+
+	fv := reflect.ValueOf(field)
+	if fv.Kind() != reflect.Ptr || fv.IsNil() { return fmt.Errorf("cannot store an attribute in %T", field) }
+	ev := fv.Elem()
+	t := ev.Type()
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+
+	switch {
+	case a.null:
+		return assignElement(ev, a)
+	case isCompositeStruct(t):
+		return m.Composite(field).Scan(src)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		return Array(field).Scan(src)
+	case t == timeType:
+		tm, err := parsePostgresTime(a.value)
+		if err != nil { return err }
+		return ConvertAssign(field, tm)
+	}
+	return assignElement(ev, a)
+}
+
+// postgresTimeFormats are the formats in which Postgres writes dates and timestamps as text.
+var postgresTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999Z07:00:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	time.RFC3339Nano,
+}
+
+// parsePostgresTime parses a date or timestamp written by Postgres.
+func parsePostgresTime(s string) (time.Time, error) {
+	for _, layout := range postgresTimeFormats {
+		if t, err := time.Parse(layout, s); err == nil { return t, nil }
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", s)
+}
+
+// Mapper.appendComposite formats v, a struct whose fields m finds, as a Postgres composite literal.
+func (m *Mapper) appendComposite(buf []byte, v reflect.Value, attributes []string) ([]byte, error) {
+	fields, err := m.GetFieldsFrom(v.Addr().Interface())
+	if err != nil { return nil, err }
+
+	order := make([]int, len(fields.Fields))
+	for i := range order { order[i] = i }
+	if attributes != nil {
+		order = order[:0]
+		for _, name := range attributes { order = append(order, indexOf(fields.Names, name)) }
+	}
+
+	buf = append(buf, '(')
+	for i, idx := range order {
+		if i > 0 { buf = append(buf, ',') }
+		if idx < 0 { continue }
+		text, null, err := m.attributeText(fields.Fields[idx])
+		if err != nil { return nil, fmt.Errorf("attribute %d (%s): %w", i, fields.Names[idx], err) }
+		if !null { buf = appendQuoted(buf, text, `(),"\`) }
+	}
+	return append(buf, ')'), nil
+}
+
+// Mapper.attributeText renders a field, as found in a NamedFields, as the text of a composite
+// attribute. Nested composites are formatted using m.
+func (m *Mapper) attributeText(field interface{}) (string, bool, error) {
+	if d, ok := field.(*defaultScanner); ok { field = d.field }
+	if valuer, ok := field.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil || value == nil { return "", value == nil, err }
+		field = value
+	}
+
+	v := reflect.ValueOf(field)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() { return "", true, nil }
+		if _, ok := v.Interface().(driver.Valuer); ok { break }
+		if isCompositeStruct(v.Elem().Type()) {
+			buf, err := m.appendComposite(nil, v.Elem(), nil)
+			return string(buf), false, err
+		}
+		v = v.Elem()
+	}
+
+	text, null, nested, err := elementText(v)
+	if err != nil || !nested.IsValid() { return text, null, err }
+	buf, err := appendArray(nil, nested)
+	return string(buf), false, err
+}
@@ -0,0 +1,204 @@
+package dml
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ConvertAssign stores src, which should be one of the types a database/sql driver produces
+// (nil, int64, float64, bool, []byte, string or time.Time), into dest, which must be a non-nil
+// pointer. It follows the same rules as database/sql does when scanning a column, so it can be
+// used by Scannables and wrappers which receive a value themselves but need to behave like *sql.Rows.
+func ConvertAssign(dest, src interface{}) error {
+	switch s := src.(type) {
+	case string:
+		switch d := dest.(type) {
+		case *string:
+			*d = s
+			return nil
+		case *[]byte:
+			*d = []byte(s)
+			return nil
+		case *sql.RawBytes:
+			*d = append((*d)[:0], s...)
+			return nil
+		}
+	case []byte:
+		switch d := dest.(type) {
+		case *string:
+			*d = string(s)
+			return nil
+		case *interface{}:
+			*d = cloneBytes(s)
+			return nil
+		case *[]byte:
+			*d = cloneBytes(s)
+			return nil
+		case *sql.RawBytes:
+			*d = s
+			return nil
+		}
+	case time.Time:
+		switch d := dest.(type) {
+		case *time.Time:
+			*d = s
+			return nil
+		case *string:
+			*d = s.Format(time.RFC3339Nano)
+			return nil
+		case *[]byte:
+			*d = []byte(s.Format(time.RFC3339Nano))
+			return nil
+		case *sql.RawBytes:
+			*d = s.AppendFormat((*d)[:0], time.RFC3339Nano)
+			return nil
+		}
+	case nil:
+		switch d := dest.(type) {
+		case *interface{}:
+			*d = nil
+			return nil
+		case *[]byte:
+			*d = nil
+			return nil
+		case *sql.RawBytes:
+			*d = nil
+			return nil
+		}
+	}
+
+	switch d := dest.(type) {
+	case *string:
+		switch reflect.ValueOf(src).Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			*d = asString(src)
+			return nil
+		}
+	case *[]byte:
+		if b, ok := asBytes(src); ok {
+			*d = b
+			return nil
+		}
+	case *bool:
+		bv, err := driver.Bool.ConvertValue(src)
+		if err == nil { *d = bv.(bool) }
+		return err
+	case *interface{}:
+		*d = src
+		return nil
+	}
+
+	if scanner, ok := dest.(sql.Scanner); ok { return scanner.Scan(src) }
+
+	dpv := reflect.ValueOf(dest)
+	if dpv.Kind() != reflect.Ptr { return errors.New("destination not a pointer") }
+	if dpv.IsNil() { return errors.New("destination pointer is nil") }
+
+	sv := reflect.ValueOf(src)
+	dv := dpv.Elem()
+	if sv.IsValid() && sv.Type().AssignableTo(dv.Type()) {
+		if b, ok := src.([]byte); ok {
+			dv.Set(reflect.ValueOf(cloneBytes(b)))
+		} else {
+			dv.Set(sv)
+		}
+		return nil
+	}
+	if sv.IsValid() && dv.Kind() == sv.Kind() && sv.Type().ConvertibleTo(dv.Type()) {
+		dv.Set(sv.Convert(dv.Type()))
+		return nil
+	}
+
+	switch dv.Kind() {
+	case reflect.Ptr:
+		if src == nil {
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+		dv.Set(reflect.New(dv.Type().Elem()))
+		return ConvertAssign(dv.Interface(), src)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if src == nil { return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind()) }
+		i, err := strconv.ParseInt(asString(src), 10, dv.Type().Bits())
+		if err != nil { return fmt.Errorf("converting %T (%q) to a %s: %w", src, asString(src), dv.Kind(), err) }
+		dv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if src == nil { return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind()) }
+		u, err := strconv.ParseUint(asString(src), 10, dv.Type().Bits())
+		if err != nil { return fmt.Errorf("converting %T (%q) to a %s: %w", src, asString(src), dv.Kind(), err) }
+		dv.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if src == nil { return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind()) }
+		f, err := strconv.ParseFloat(asString(src), dv.Type().Bits())
+		if err != nil { return fmt.Errorf("converting %T (%q) to a %s: %w", src, asString(src), dv.Kind(), err) }
+		dv.SetFloat(f)
+		return nil
+	case reflect.String:
+		if src == nil { return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind()) }
+		switch v := src.(type) {
+		case string:
+			dv.SetString(v)
+			return nil
+		case []byte:
+			dv.SetString(string(v))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type %T", src, dest)
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil { return nil }
+	return append([]byte(nil), b...)
+}
+
+func asString(src interface{}) string {
+	switch v := src.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	rv := reflect.ValueOf(src)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 64)
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 32)
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool())
+	}
+	return fmt.Sprintf("%v", src)
+}
+
+func asBytes(src interface{}) ([]byte, bool) {
+	rv := reflect.ValueOf(src)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(nil, rv.Uint(), 10), true
+	case reflect.Float32:
+		return strconv.AppendFloat(nil, rv.Float(), 'g', -1, 32), true
+	case reflect.Float64:
+		return strconv.AppendFloat(nil, rv.Float(), 'g', -1, 64), true
+	case reflect.Bool:
+		return strconv.AppendBool(nil, rv.Bool()), true
+	case reflect.String:
+		return []byte(rv.String()), true
+	}
+	return nil, false
+}
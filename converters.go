@@ -0,0 +1,201 @@
+package dml
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Converters is a registry of functions which transform column values on their way into fields
+// of a particular type, for types which can't (or shouldn't) implement sql.Scanner themselves.
+// Converters are added with AddConverter, or to DefaultConverters with RegisterConverter.
+type Converters struct {
+	lock  sync.RWMutex
+	byDst map[reflect.Type][]*converter
+}
+
+// NewConverters returns an empty converter registry.
+func NewConverters() *Converters {
+	return &Converters{byDst: make(map[reflect.Type][]*converter)}
+}
+
+// DefaultConverters is the registry consulted by Scan, ScanWithFields and ScanArray, as it is
+// DefaultMapper's Converters unless that is replaced.
+var DefaultConverters = NewConverters()
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// converter is a single registered conversion from src to dst. accepts reports whether a value
+// is already of type src, and assign converts a value and stores it through a pointer to dst.
+type converter struct {
+	src, dst reflect.Type
+	accepts  func(src interface{}) bool
+	assign   func(dst, src interface{}) error
+}
+
+// AddConverter registers fn, which must be a func(T) (U, error), with c, so that columns scanned
+// into fields of type U are passed through fn. Values which aren't already of type T are first
+// converted to T the way database/sql would (see ConvertAssign). Registering a second function with
+// the same T and U replaces the first.
+//
+// When several converters produce the same U, the one whose T best matches the column's scan type
+// is chosen, once per result set, when the ScanMap is built. If the scan type isn't known, the
+// choice is made for each value according to its type. If no converter suits the column, the
+// field is scanned into as usual.
+func AddConverter(c *Converters, fn interface{}) error {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() || fv.Type().IsVariadic() || fv.Type().NumIn() != 1 || fv.Type().NumOut() != 2 || fv.Type().Out(1) != errorType {
+		return fmt.Errorf("converter must be a func(T) (U, error), not %T", fn)
+	}
+	ft := fv.Type()
+
+	src, dst := ft.In(0), ft.Out(0)
+	accepts := func(s interface{}) bool {
+		if s == nil { return false }
+		st := reflect.TypeOf(s)
+		return st == src || (src.Kind() == reflect.Interface && st.Implements(src))
+	}
+	conv := &converter{
+		src: src,
+		dst: dst,
+		accepts: accepts,
+		assign: func(d, s interface{}) error {
+			v := reflect.New(src).Elem()
+			if accepts(s) {
+				v.Set(reflect.ValueOf(s))
+			} else if err := ConvertAssign(v.Addr().Interface(), s); err != nil {
+				return err
+			}
+			out := fv.Call([]reflect.Value{v})
+			if err, _ := out[1].Interface().(error); err != nil { return err }
+			reflect.ValueOf(d).Elem().Set(out[0])
+			return nil
+		},
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing := c.byDst[conv.dst]
+	for i, e := range existing {
+		if e.src == conv.src {
+			existing[i] = conv
+			return nil
+		}
+	}
+	c.byDst[conv.dst] = append(existing, conv)
+	return nil
+}
+
+// RegisterConverter registers fn with DefaultConverters. See AddConverter.
+func RegisterConverter(fn interface{}) error {
+	return AddConverter(DefaultConverters, fn)
+}
+
+// choose picks the converter to use for a column described by col, scanned into field, or nil
+// if there isn't a suitable one.
+func (c *Converters) choose(col ColumnInfo, field interface{}) *converter {
+	candidates := c.byDst[convertTarget(field)]
+	if len(candidates) == 0 { return nil }
+
+	st := col.ScanType
+	if wrapped, ok := nullTypes[st]; ok { st = wrapped }
+	if st == nil {
+		if len(candidates) == 1 { return candidates[0] }
+		return dispatch(candidates)
+	}
+
+	for _, conv := range candidates {
+		if conv.src == st { return conv }
+	}
+	for _, conv := range candidates {
+		if class := classify(conv.src); class != classUnknown && class == classify(st) { return conv }
+	}
+	return nil
+}
+
+// dispatch combines several converters with the same destination into one which chooses between
+// them according to the type of each value, falling back to the first.
+func dispatch(candidates []*converter) *converter {
+	return &converter{
+		src: candidates[0].src,
+		dst: candidates[0].dst,
+		accepts: func(src interface{}) bool { return true },
+		assign: func(dst, src interface{}) error {
+			for _, conv := range candidates {
+				if conv.accepts(src) { return conv.assign(dst, src) }
+			}
+			return candidates[0].assign(dst, src)
+		},
+	}
+}
+
+// convertTarget returns the type a converter must produce to be used for field, as found in a
+// NamedFields: the type field points to, seen through the wrappers of fields with defaults and of
+// fields behind nil embedded pointers. It is nil for fields which converters can't be used for.
+func convertTarget(field interface{}) reflect.Type {
+	if l, ok := field.(*lazyField); ok { field = l.placeholder() }
+	if d, ok := field.(*defaultScanner); ok { field = d.field }
+	ft := reflect.TypeOf(field)
+	if ft == nil || ft.Kind() != reflect.Ptr { return nil }
+	return ft.Elem()
+}
+
+// boundConverter is a converter aimed at a particular field, so that it can be passed to Scan.
+type boundConverter struct {
+	*converter
+	dst interface{}
+}
+
+// boundConverter.Scan converts src and stores it into the field.
+func (b *boundConverter) Scan(src interface{}) error {
+	return b.assignTo(b.dst, src)
+}
+
+// boundConverter.assignTo converts src and stores it into dst, a field as found in a NamedFields.
+// Fields with defaults receive their default when src is NULL, and fields behind nil embedded
+// pointers have the pointers allocated first.
+func (b *boundConverter) assignTo(dst, src interface{}) error {
+	switch d := dst.(type) {
+	case *defaultScanner:
+		if src == nil { return d.applyDefault() }
+		return b.assign(d.field, src)
+	case *lazyField:
+		field, err := d.Field()
+		if err != nil { return err }
+		return b.assignTo(field, src)
+	}
+	return b.assign(dst, src)
+}
+
+// conversions holds the converter chosen for each column of a result set, or nil for columns
+// which are scanned as usual. Its entries are re-aimed at the fields of each row as it is scanned.
+type conversions []*boundConverter
+
+// buildConversions chooses converters from c for each column of adv which m maps to a field.
+// It returns nil if no column needs one, which is always the case when c is empty.
+func (c *Converters) buildConversions(adv AdvancedScannable, m ScanMap, fields NamedFields) (conversions, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.byDst) == 0 || m == nil { return nil, nil }
+
+	var columns []ColumnInfo
+	var output conversions
+	for i, idx := range m {
+		if idx < 0 { continue }
+		if c.byDst[convertTarget(fields.Fields[idx])] == nil { continue }
+
+		if columns == nil {
+			var err error
+			if columns, err = ColumnsOf(adv); err != nil { return nil, err }
+		}
+		var col ColumnInfo
+		if i < len(columns) { col = columns[i] }
+
+		if conv := c.choose(col, fields.Fields[idx]); conv != nil {
+			if output == nil { output = make(conversions, len(m)) }
+			output[i] = &boundConverter{converter: conv}
+		}
+	}
+
+	return output, nil
+}
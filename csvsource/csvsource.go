@@ -0,0 +1,111 @@
+// Package csvsource reads CSV files as result sets, so that the structs which are scanned from
+// the database can be loaded from CSV exports the same way:
+//
+//     src := csvsource.New(csv.NewReader(f))
+//     err := dml.ScanArray(src, &users)
+//
+// The first record is the header, which names the columns. Cells are stored into fields as
+// database/sql would store a column holding their text (see dml.ConvertAssign), so numbers and
+// booleans are parsed, and sql.Scanner implementations receive the text, except that fields of type
+// time.Time (or *time.Time) are parsed using TimeLayouts.
+package csvsource
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/thewug/dml/internal/assign"
+)
+
+// Source is a dml.IterableScannable which reads rows from a CSV file.
+type Source struct {
+	// TimeLayouts are the layouts tried, in order, when a cell is stored in a time.Time.
+	// New sets it to RFC 3339, and then just a date.
+	TimeLayouts []string
+
+	// EmptyIsNull makes empty cells NULL, rather than empty strings, so that they can be stored in
+	// pointers and sql.Null types, and leave fields with defaults at their defaults.
+	EmptyIsNull bool
+
+	reader *csv.Reader
+	header []string
+	record []string
+	row    int
+	err    error
+	done   bool
+}
+
+// New returns a Source which reads from r. Nothing is read until the columns or the first row are
+// asked for, so r can still be configured (for example, with a different separator) in the meantime.
+func New(r *csv.Reader) *Source {
+	return &Source{TimeLayouts: []string{time.RFC3339Nano, "2006-01-02"}, reader: r}
+}
+
+// Source.readHeader reads the header, if it hasn't been read yet.
+func (s *Source) readHeader() error {
+	if s.header != nil || s.err != nil { return s.err }
+	header, err := s.reader.Read()
+	if err == io.EOF { err = errors.New("csvsource: missing header") }
+	if err != nil {
+		s.err = err
+		return err
+	}
+	// the reader may reuse its record, so the header must be kept separately.
+	s.header = append([]string(nil), header...)
+	return nil
+}
+
+// Source.ColumnNames returns the names in the header.
+func (s *Source) ColumnNames() ([]string, error) {
+	if err := s.readHeader(); err != nil { return nil, err }
+	return s.header, nil
+}
+
+// Source.Next reads the next row, returning false at the end of the file or if there is an error,
+// which Err then returns.
+func (s *Source) Next() bool {
+	if s.done || s.readHeader() != nil { return false }
+	record, err := s.reader.Read()
+	if err != nil {
+		if err != io.EOF { s.err = err }
+		s.done, s.record = true, nil
+		return false
+	}
+	s.record = record
+	s.row++
+	return true
+}
+
+// Source.Err returns the error which ended the iteration, or nil if it reached the end of the file.
+func (s *Source) Err() error {
+	return s.err
+}
+
+// Source.Close ends the iteration. It doesn't close the file the reader reads from, which belongs to the caller.
+func (s *Source) Close() error {
+	s.done, s.record = true, nil
+	return nil
+}
+
+// Source.Scan stores the cells of the current row into dest, one per column.
+func (s *Source) Scan(dest ...interface{}) error {
+	if s.record == nil { return errors.New("csvsource: Scan called without a row") }
+	if len(dest) != len(s.record) { return fmt.Errorf("csvsource: expected %d destination arguments in Scan, not %d", len(s.record), len(dest)) }
+	for i, d := range dest {
+		var src interface{} = s.record[i]
+		if s.EmptyIsNull && s.record[i] == "" { src = nil }
+		if err := assign.Value(d, src, s.parseTime); err != nil { return fmt.Errorf("csvsource: row %d, column %q: %w", s.row, s.header[i], err) }
+	}
+	return nil
+}
+
+// Source.parseTime parses cell with the first of TimeLayouts which accepts it.
+func (s *Source) parseTime(cell string) (time.Time, error) {
+	for _, layout := range s.TimeLayouts {
+		if t, err := time.Parse(layout, cell); err == nil { return t, nil }
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", cell)
+}
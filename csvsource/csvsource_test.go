@@ -0,0 +1,102 @@
+package csvsource
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+type level int
+
+func (l *level) Scan(src interface{}) error {
+	switch src {
+	case "low": *l = 1
+	case "high": *l = 2
+	default: *l = 0
+	}
+	return nil
+}
+
+type record struct {
+	Id      int64          `dml:"id"`
+	Name    string         `dml:"name"`
+	Score   float64        `dml:"score"`
+	Active  bool           `dml:"active"`
+	Created time.Time      `dml:"created"`
+	Updated *time.Time     `dml:"updated"`
+	Level   level          `dml:"level"`
+	Note    sql.NullString `dml:"note"`
+	Retries int            `dml:"retries,default=3"`
+}
+
+type Stamp struct {
+	Created time.Time `dml:"created"`
+}
+
+type stamped struct {
+	*Stamp
+	Id int64 `dml:"id"`
+}
+
+const data = `name,id,score,active,created,updated,level,note,retries,ignored
+a,1,1.5,true,2024-01-02T03:04:05Z,2024-01-03,high,hello,5,x
+b,2,-2,false,2024-01-02,,low,,,y
+`
+
+func Test_ScanArray(t *testing.T) {
+	src := New(csv.NewReader(strings.NewReader(data)))
+	src.EmptyIsNull = true
+	var out []record
+	if err := dml.ScanArray(src, &out); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	if err := src.Err(); err != nil { t.Errorf("Unexpected return value (Err): got %v, expected nil", err) }
+
+	updated := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	expected := []record{
+		{1, "a", 1.5, true, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), &updated, 2, sql.NullString{String: "hello", Valid: true}, 5},
+		{2, "b", -2, false, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), nil, 1, sql.NullString{}, 3},
+	}
+	if !reflect.DeepEqual(out, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", out, expected) }
+}
+
+func Test_Errors(t *testing.T) {
+	testcases := map[string]struct{
+		data string
+		err string
+	}{
+		"empty":   {"", "missing header"},
+		"int":     {"id\nx\n", `row 1, column "id": converting string ("x") to a int64`},
+		"time":    {"id,created\n1,yesterday\n", `row 1, column "created": cannot parse "yesterday" as a time`},
+		"ragged":  {"id,name\n1,a\n2\n", "wrong number of fields"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			src := New(csv.NewReader(strings.NewReader(v.data)))
+			var out []record
+			err := dml.ScanArray(src, &out)
+			if err == nil { err = src.Err() }
+			if err == nil || !strings.Contains(err.Error(), v.err) { t.Errorf("Unexpected error: got %v, expected %q", err, v.err) }
+		})
+	}
+}
+
+func Test_Layouts(t *testing.T) {
+	src := New(csv.NewReader(strings.NewReader("created\n02/01/2024\n")))
+	src.TimeLayouts = []string{"02/01/2006"}
+	src.Next()
+	var x record
+	if err := dml.Scan(src, &x); err != nil || !x.Created.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) { t.Errorf("Unexpected result (Scan): got %v, %v", x.Created, err) }
+	if src.Next() || src.Err() != nil { t.Errorf("Expected the end of the file") }
+
+	// times behind nil embedded pointers are parsed too.
+	src = New(csv.NewReader(strings.NewReader("id,created\n1,02/01/2024\n")))
+	src.TimeLayouts = []string{"02/01/2006"}
+	src.Next()
+	var s stamped
+	if err := dml.Scan(src, &s); err != nil || s.Stamp == nil || !s.Created.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) { t.Errorf("Unexpected result (Scan): got %+v, %v", s, err) }
+}
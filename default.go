@@ -0,0 +1,111 @@
+package dml
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// defaultScanner wraps a pointer to a field, storing value into it when scanned from NULL.
+// ScanWithMappedFields also recognizes it, and stores value into fields whose columns are missing.
+type defaultScanner struct {
+	field interface{}
+	value reflect.Value
+}
+
+// Default wraps field, which must be a pointer, so that value is stored into it instead when its
+// column is NULL or missing from the result set. Other values are stored as database/sql would
+// store them (see ConvertAssign). value must be convertible to the type field points to, or, if
+// that is itself a pointer, to the type it points to. This is what the `default=` tag option does,
+// and can be used in GetFields implementations to the same effect.
+func Default(field interface{}, value interface{}) sql.Scanner {
+	return &defaultScanner{field: field, value: reflect.ValueOf(value)}
+}
+
+// defaultScanner.Scan stores the default if src is NULL, and src itself otherwise.
+func (d *defaultScanner) Scan(src interface{}) error {
+	if src == nil { return d.applyDefault() }
+	return ConvertAssign(d.field, src)
+}
+
+// defaultScanner.applyDefault stores the default value into the field.
+func (d *defaultScanner) applyDefault() error {
+	dv := reflect.ValueOf(d.field)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() { return fmt.Errorf("cannot store a default value in %T", d.field) }
+	dv = dv.Elem()
+	if !d.value.IsValid() { return fmt.Errorf("default value for %v is nil", dv.Type()) }
+	target := dv.Type()
+	if target.Kind() == reflect.Ptr && d.value.Type() != target { target = target.Elem() }
+	if !d.value.Type().ConvertibleTo(target) { return fmt.Errorf("default value of type %v cannot be stored in %v", d.value.Type(), dv.Type()) }
+
+	value := d.value.Convert(target)
+	if target != dv.Type() {
+		p := reflect.New(target)
+		p.Elem().Set(value)
+		value = p
+	}
+	dv.Set(value)
+	return nil
+}
+
+// applyMissingDefaults stores the default values of any defaultScanners in fields which are not
+// the target of any column in m. Fields under nil embedded pointers only receive their defaults if
+// the embedded struct was allocated to scan another of its columns.
+func applyMissingDefaults(m ScanMap, fields NamedFields) error {
+	var used []bool
+	for i, f := range fields.Fields {
+		d, ok := f.(*defaultScanner)
+		if l, lazy := f.(*lazyField); lazy { d, ok = l.defaults() }
+		if !ok { continue }
+		if used == nil {
+			used = make([]bool, len(fields.Fields))
+			for _, idx := range m {
+				if idx >= 0 { used[idx] = true }
+			}
+		}
+		if !used[i] {
+			if err := d.applyDefault(); err != nil { return err }
+		}
+	}
+	return nil
+}
+
+// ParseDefault parses the value of a `default=` tag option for a field of type t. The result is
+// of t's underlying basic type (or, for a pointer, of the type it points to), and is suitable for
+// passing to Default. Only fields of boolean, numeric and string kinds can have defaults.
+func ParseDefault(t reflect.Type, s string) (interface{}, error) {
+	v, err := parseDefault(t, s)
+	if err != nil { return nil, err }
+	return v.Interface(), nil
+}
+
+func parseDefault(t reflect.Type, s string) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+
+	var output interface{}
+	var err error
+	switch t.Kind() {
+	case reflect.Bool:
+		output, err = strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(s, 0, t.Bits())
+		output = reflect.ValueOf(i).Convert(t).Interface()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(s, 0, t.Bits())
+		output = reflect.ValueOf(u).Convert(t).Interface()
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(s, t.Bits())
+		output = reflect.ValueOf(f).Convert(t).Interface()
+	case reflect.String:
+		output = reflect.ValueOf(s).Convert(t).Interface()
+	default:
+		return reflect.Value{}, fmt.Errorf("default values are not supported for fields of type %v", t)
+	}
+	if err != nil { return reflect.Value{}, fmt.Errorf("bad default value %q for field of type %v: %w", s, t, err) }
+
+	return reflect.ValueOf(output), nil
+}
@@ -0,0 +1,200 @@
+// Package dmlpgx adapts the rows returned by pgx, which describe their columns with
+// FieldDescriptions rather than ColumnTypes, so that dml can scan them directly:
+//
+//     rows, err := dmlpgx.X(conn.Query(ctx, query))
+//     if err != nil { return err }
+//     defer rows.Close()
+//     err = dml.ScanArray(rows, &users)
+//
+// It doesn't depend on pgx itself. Instead, Rows declares the methods of pgx.Rows which dml needs,
+// and the FieldDescriptions method and the field descriptions it returns are found by reflection,
+// so any type shaped like pgconn.FieldDescription (with Name, DataTypeOID and, optionally,
+// TypeModifier fields) can be used. That includes pgx v4's pgproto3.FieldDescription, whose Name
+// is a []byte rather than a string.
+package dmlpgx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+// Rows is the subset of pgx.Rows which the adapter uses. The rows must also have a
+// FieldDescriptions method returning a slice of field descriptions, which for pgx are
+// pgconn.FieldDescriptions; since their type can't be named here, it is called by reflection.
+type Rows interface {
+	Close()
+	Err() error
+	Next() bool
+	Scan(dest ...interface{}) error
+}
+
+// adapter makes Rows into a dml.ColumnInfoScannable. Like dml.X's adapter, the column information
+// is computed once per result set and cached.
+type adapter struct {
+	rows    Rows
+	columns []dml.ColumnInfo
+	names   []string
+}
+
+// Wrap adapts rows for use with dml.
+func Wrap(rows Rows) dml.IterableScannable {
+	return &adapter{rows: rows}
+}
+
+// X adapts the rows returned by a pgx query for use with dml, passing its error through, so that
+// it can wrap the query directly. The result is nil if rows is.
+func X(rows Rows, err error) (dml.IterableScannable, error) {
+	if rows == nil { return nil, err }
+	return Wrap(rows), err
+}
+
+// adapter.Scan passes straight through to pgx, which handles the sql.Scanner values dml passes it.
+func (a *adapter) Scan(dest ...interface{}) error {
+	return a.rows.Scan(dest...)
+}
+
+// adapter.Next passes straight through to pgx.
+func (a *adapter) Next() bool {
+	return a.rows.Next()
+}
+
+// adapter.Err passes straight through to pgx.
+func (a *adapter) Err() error {
+	return a.rows.Err()
+}
+
+// adapter.Close closes the rows, and returns any error which ended the iteration, since pgx reports
+// errors from Close that way.
+func (a *adapter) Close() error {
+	a.rows.Close()
+	a.columns, a.names = nil, nil
+	return a.rows.Err()
+}
+
+// adapter.ColumnNames returns the names of the columns, from their field descriptions.
+func (a *adapter) ColumnNames() ([]string, error) {
+	if a.names != nil { return a.names, nil }
+	if _, err := a.Columns(); err != nil { return nil, err }
+	return a.names, nil
+}
+
+// adapter.Columns describes the columns from their field descriptions. The database type name and
+// scan type are known for the common built in types; for others, only the name is.
+func (a *adapter) Columns() ([]dml.ColumnInfo, error) {
+	if a.columns != nil { return a.columns, nil }
+	fds, err := fieldDescriptions(a.rows)
+	if err != nil { return nil, err }
+	columns := make([]dml.ColumnInfo, fds.Len())
+	names := make([]string, fds.Len())
+	for i := range columns {
+		fd, err := readFieldDescription(fds.Index(i))
+		if err != nil { return nil, err }
+		columns[i] = fd.columnInfo()
+		names[i] = fd.name
+	}
+	a.columns, a.names = columns, names
+	return columns, nil
+}
+
+// fieldDescription holds the parts of a pgconn.FieldDescription which the adapter uses.
+type fieldDescription struct {
+	name        string
+	oid         uint32
+	modifier    int32
+	hasModifier bool
+}
+
+// fieldDescriptions calls the FieldDescriptions method of rows, which must return a slice.
+func fieldDescriptions(rows Rows) (reflect.Value, error) {
+	method := reflect.ValueOf(rows).MethodByName("FieldDescriptions")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 || method.Type().Out(0).Kind() != reflect.Slice {
+		return reflect.Value{}, fmt.Errorf("rows of type %T have no FieldDescriptions method returning a slice", rows)
+	}
+	return method.Call(nil)[0], nil
+}
+
+// readFieldDescription reads a fieldDescription from v, a struct shaped like pgconn.FieldDescription
+// (pgx v5) or pgproto3.FieldDescription (pgx v4, where Name is a []byte).
+func readFieldDescription(v reflect.Value) (fieldDescription, error) {
+	for v.Kind() == reflect.Ptr && !v.IsNil() { v = v.Elem() }
+	if v.Kind() != reflect.Struct { return fieldDescription{}, fmt.Errorf("field descriptions of type %v are not structs", v.Type()) }
+
+	var fd fieldDescription
+	name := v.FieldByName("Name")
+	oid := v.FieldByName("DataTypeOID")
+	if oid.Kind() != reflect.Uint32 { return fieldDescription{}, errors.New("field descriptions need Name and DataTypeOID fields") }
+	switch {
+	case name.Kind() == reflect.String:
+		fd.name = name.String()
+	case name.Kind() == reflect.Slice && name.Type().Elem().Kind() == reflect.Uint8:
+		fd.name = string(name.Bytes())
+	default:
+		return fieldDescription{}, errors.New("field descriptions need Name and DataTypeOID fields")
+	}
+	fd.oid = uint32(oid.Uint())
+	if modifier := v.FieldByName("TypeModifier"); modifier.Kind() == reflect.Int32 {
+		fd.modifier, fd.hasModifier = int32(modifier.Int()), true
+	}
+	return fd, nil
+}
+
+// postgresType describes one of the built in types which the adapter knows about.
+type postgresType struct {
+	name     string
+	scanType reflect.Type
+}
+
+// postgresTypes maps the OIDs of the common built in types to their names, as the pgx database/sql
+// driver reports them, and the types pgx scans them into most naturally.
+var postgresTypes = map[uint32]postgresType{
+	16:   {"BOOL", reflect.TypeOf(false)},
+	17:   {"BYTEA", reflect.TypeOf([]byte(nil))},
+	18:   {"CHAR", reflect.TypeOf("")},
+	19:   {"NAME", reflect.TypeOf("")},
+	20:   {"INT8", reflect.TypeOf(int64(0))},
+	21:   {"INT2", reflect.TypeOf(int16(0))},
+	23:   {"INT4", reflect.TypeOf(int32(0))},
+	25:   {"TEXT", reflect.TypeOf("")},
+	26:   {"OID", reflect.TypeOf(uint32(0))},
+	114:  {"JSON", nil},
+	700:  {"FLOAT4", reflect.TypeOf(float32(0))},
+	701:  {"FLOAT8", reflect.TypeOf(float64(0))},
+	1000: {"_BOOL", nil},
+	1005: {"_INT2", nil},
+	1007: {"_INT4", nil},
+	1009: {"_TEXT", nil},
+	1015: {"_VARCHAR", nil},
+	1016: {"_INT8", nil},
+	1021: {"_FLOAT4", nil},
+	1022: {"_FLOAT8", nil},
+	1042: {"BPCHAR", reflect.TypeOf("")},
+	1043: {"VARCHAR", reflect.TypeOf("")},
+	1082: {"DATE", reflect.TypeOf(time.Time{})},
+	1083: {"TIME", nil},
+	1114: {"TIMESTAMP", reflect.TypeOf(time.Time{})},
+	1184: {"TIMESTAMPTZ", reflect.TypeOf(time.Time{})},
+	1186: {"INTERVAL", nil},
+	1700: {"NUMERIC", nil},
+	2950: {"UUID", nil},
+	3802: {"JSONB", nil},
+}
+
+// fieldDescription.columnInfo describes the column. Lengths and decimal sizes come from the type
+// modifier, which Postgres offsets by 4 for the types which have one.
+func (fd fieldDescription) columnInfo() dml.ColumnInfo {
+	c := dml.ColumnInfo{Name: fd.name}
+	if t, ok := postgresTypes[fd.oid]; ok { c.DatabaseTypeName, c.ScanType = t.name, t.scanType }
+	if !fd.hasModifier || fd.modifier < 4 { return c }
+
+	switch c.DatabaseTypeName {
+	case "VARCHAR", "BPCHAR":
+		c.Length, c.HasLength = int64(fd.modifier - 4), true
+	case "NUMERIC":
+		c.Precision, c.Scale, c.HasPrecisionScale = int64((fd.modifier - 4) >> 16 & 0xffff), int64((fd.modifier - 4) & 0xffff), true
+	}
+	return c
+}
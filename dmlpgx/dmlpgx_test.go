@@ -0,0 +1,176 @@
+package dmlpgx
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+// FieldDescription mirrors pgconn.FieldDescription.
+type FieldDescription struct {
+	Name                 string
+	TableOID             uint32
+	TableAttributeNumber uint16
+	DataTypeOID          uint32
+	DataTypeSize         int16
+	TypeModifier         int32
+	Format               int16
+}
+
+// fakeRows is a hand-written stand-in for pgx.Rows, which scans as pgx does for the types used here.
+type fakeRows struct {
+	fields []FieldDescription
+	values [][]interface{}
+	row    int
+	err    error
+	closed bool
+}
+
+func (f *fakeRows) Close() { f.closed = true }
+func (f *fakeRows) Err() error { return f.err }
+func (f *fakeRows) FieldDescriptions() []FieldDescription { return f.fields }
+
+func (f *fakeRows) Next() bool {
+	if f.closed || f.row >= len(f.values) { return false }
+	f.row++
+	return true
+}
+
+func (f *fakeRows) Scan(dest ...interface{}) error {
+	values := f.values[f.row - 1]
+	if len(dest) != len(values) { return errors.New("wrong number of destinations") }
+	for i, d := range dest {
+		if scanner, ok := d.(sql.Scanner); ok {
+			if err := scanner.Scan(values[i]); err != nil { return err }
+			continue
+		}
+		if err := dml.ConvertAssign(d, values[i]); err != nil { return err }
+	}
+	return nil
+}
+
+type user struct {
+	Id      int64     `dml:"id"`
+	Name    string    `dml:"name"`
+	Tags    []string  `dml:"tags"`
+	Created time.Time `dml:"created"`
+}
+
+func newFakeRows() *fakeRows {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &fakeRows{
+		fields: []FieldDescription{
+			{Name: "name", DataTypeOID: 1043, TypeModifier: 68},
+			{Name: "id", DataTypeOID: 20, TypeModifier: -1},
+			{Name: "tags", DataTypeOID: 1009, TypeModifier: -1},
+			{Name: "created", DataTypeOID: 1184, TypeModifier: -1},
+			{Name: "price", DataTypeOID: 1700, TypeModifier: 10 << 16 | 2 + 4},
+		},
+		values: [][]interface{}{
+			{"a", int64(1), `{x,y}`, created, "1.50"},
+			{"b", int64(2), nil, created, nil},
+		},
+	}
+}
+
+func Test_Columns(t *testing.T) {
+	rows := Wrap(newFakeRows())
+	names, err := rows.ColumnNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"name", "id", "tags", "created", "price"}) { t.Errorf("Unexpected return value (ColumnNames): got %v, %v", names, err) }
+
+	columns, err := rows.(dml.ColumnInfoScannable).Columns()
+	if err != nil || len(columns) != 5 { t.Fatalf("Unexpected return value (Columns): got %+v, %v", columns, err) }
+	expected := []dml.ColumnInfo{
+		{Name: "name", DatabaseTypeName: "VARCHAR", ScanType: reflect.TypeOf(""), Length: 64, HasLength: true},
+		{Name: "id", DatabaseTypeName: "INT8", ScanType: reflect.TypeOf(int64(0))},
+		{Name: "tags", DatabaseTypeName: "_TEXT"},
+		{Name: "created", DatabaseTypeName: "TIMESTAMPTZ", ScanType: reflect.TypeOf(time.Time{})},
+		{Name: "price", DatabaseTypeName: "NUMERIC", Precision: 10, Scale: 2, HasPrecisionScale: true},
+	}
+	if !reflect.DeepEqual(columns, expected) { t.Errorf("Unexpected return value (Columns): got %+v, expected %+v", columns, expected) }
+
+	v4 := &v4Rows{fields: []v4FieldDescription{{Name: []byte("name"), DataTypeOID: 1043, TypeModifier: 68}, {Name: []byte("id"), DataTypeOID: 20, TypeModifier: -1}}}
+	columns, err = Wrap(v4).(dml.ColumnInfoScannable).Columns()
+	if err != nil || !reflect.DeepEqual(columns, expected[:2]) { t.Errorf("Unexpected return value (Columns, v4): got %+v, %v, expected %+v", columns, err, expected[:2]) }
+
+	_, err = Wrap(&badRows{fields: []bad{{"x"}}}).ColumnNames()
+	if err == nil || !strings.Contains(err.Error(), "Name and DataTypeOID") { t.Errorf("Unexpected return value (ColumnNames): got %v, expected an error", err) }
+
+	_, err = Wrap(&noFieldsRows{}).ColumnNames()
+	if err == nil || !strings.Contains(err.Error(), "no FieldDescriptions method") { t.Errorf("Unexpected return value (ColumnNames): got %v, expected an error", err) }
+}
+
+// bad is a field description without the fields the adapter needs.
+type bad struct { Label string }
+
+// badRows is an empty fakeRows whose field descriptions are bad.
+type badRows struct {
+	fakeRows
+	fields []bad
+}
+
+func (b *badRows) FieldDescriptions() []bad { return b.fields }
+
+// v4FieldDescription mirrors pgx v4's pgproto3.FieldDescription, whose Name is a []byte.
+type v4FieldDescription struct {
+	Name                 []byte
+	TableOID             uint32
+	TableAttributeNumber uint16
+	DataTypeOID          uint32
+	DataTypeSize         int16
+	TypeModifier         int32
+	Format               int16
+}
+
+// v4Rows is an empty fakeRows whose field descriptions are shaped as in pgx v4.
+type v4Rows struct {
+	fakeRows
+	fields []v4FieldDescription
+}
+
+func (v *v4Rows) FieldDescriptions() []v4FieldDescription { return v.fields }
+
+// noFieldsRows has no FieldDescriptions method at all.
+type noFieldsRows struct{}
+
+func (n *noFieldsRows) Close() {}
+func (n *noFieldsRows) Err() error { return nil }
+func (n *noFieldsRows) Next() bool { return false }
+func (n *noFieldsRows) Scan(dest ...interface{}) error { return nil }
+
+func Test_Scan(t *testing.T) {
+	fake := newFakeRows()
+	rows, err := X(fake, nil)
+	if err != nil { t.Fatalf("Unexpected return value (X): got %v, expected nil", err) }
+
+	var users []user
+	if err := dml.ScanArray(rows, &users); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expected := []user{{1, "a", []string{"x", "y"}, created}, {2, "b", nil, created}}
+	if !reflect.DeepEqual(users, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", users, expected) }
+
+	fake.err = errors.New("connection reset")
+	if err := rows.Close(); err != fake.err || !fake.closed { t.Errorf("Unexpected return value (Close): got %v, closed %v", err, fake.closed) }
+
+	rows, err = X(nil, fake.err)
+	if rows != nil || err != fake.err { t.Errorf("Unexpected return value (X): got %v, %v", rows, err) }
+}
+
+func Test_Validate(t *testing.T) {
+	type mismatch struct {
+		Name time.Time `dml:"name"`
+	}
+
+	m := dml.NewMapper()
+	m.ValidateTypes = true
+	rows := Wrap(newFakeRows())
+	rows.Next()
+	var x mismatch
+	err := m.Scan(rows, &x)
+	if _, ok := err.(dml.TypeMismatchError); !ok { t.Errorf("Unexpected return value (Scan): got %v, expected a TypeMismatchError", err) }
+}
@@ -0,0 +1,278 @@
+package dmltest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// DriverName is the name the dmltest driver is registered with database/sql under. Its data
+// source names are the names of Servers, so sql.Open(DriverName, server.Name()) connects to server.
+const DriverName = "dmltest"
+
+func init() {
+	sql.Register(DriverName, testDriver{})
+}
+
+// Server holds the canned results which connections made by the dmltest driver serve, and records
+// the statements they execute. Each query is answered by the most recently added result whose
+// pattern matches it, so tests can add general results first and override them for specific
+// queries; a query with no matching result fails. A Server is safe for concurrent use.
+type Server struct {
+	name       string
+	lock       sync.Mutex
+	results    []*Result
+	statements []Statement
+}
+
+// Result is a canned response to the queries which match its pattern.
+type Result struct {
+	server   *Server
+	pattern  *regexp.Regexp
+	columns  []string
+	data     [][]interface{}
+	err      error
+	affected int64
+	nextErrs map[int]error
+}
+
+// Statement is a statement executed through a Server, with its arguments as the driver received them.
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+var (
+	servers     sync.Map
+	serverCount int64
+)
+
+// NewServer returns an empty Server, registered so that the dmltest driver can connect to it.
+func NewServer() *Server {
+	s := &Server{name: "server" + strconv.FormatInt(atomic.AddInt64(&serverCount, 1), 10)}
+	servers.Store(s.name, s)
+	return s
+}
+
+// Server.Name returns the data source name which connects to s.
+func (s *Server) Name() string {
+	return s.name
+}
+
+// Server.DB opens a *sql.DB connected to s.
+func (s *Server) DB() *sql.DB {
+	return sql.OpenDB(connector{s})
+}
+
+// Server.Close unregisters s, so that no more connections can be made to it.
+func (s *Server) Close() error {
+	servers.Delete(s.name)
+	return nil
+}
+
+// Server.add adds a result for queries matching pattern, a regular expression.
+func (s *Server) add(pattern string, r *Result) *Result {
+	r.server, r.pattern = s, regexp.MustCompile(pattern)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results = append(s.results, r)
+	return r
+}
+
+// Server.Query makes queries matching pattern, a regular expression, return the given columns
+// and rows. The values are converted as a driver would convert them.
+func (s *Server) Query(pattern string, columns []string, data ...[]interface{}) *Result {
+	return s.add(pattern, &Result{columns: columns, data: data})
+}
+
+// Server.QueryStructs makes queries matching pattern return the values of rows, a slice of tagged
+// structs, as FromStructs does.
+func (s *Server) QueryStructs(pattern string, rows interface{}) (*Result, error) {
+	r, err := FromStructs(rows)
+	if err != nil { return nil, err }
+	return s.Query(pattern, r.columns, r.data...), nil
+}
+
+// Server.Exec makes statements matching pattern report that they affected the given number of rows.
+func (s *Server) Exec(pattern string, affected int64) *Result {
+	return s.add(pattern, &Result{affected: affected})
+}
+
+// Server.Fail makes statements matching pattern fail with err.
+func (s *Server) Fail(pattern string, err error) *Result {
+	return s.add(pattern, &Result{err: err})
+}
+
+// Result.FailNext makes reading the row with the given index (counting from 0) fail with err, as if
+// the connection had failed while reading it. See Rows.FailNext. It is safe to call while queries
+// are running.
+func (r *Result) FailNext(row int, err error) *Result {
+	r.server.lock.Lock()
+	defer r.server.lock.Unlock()
+	if r.nextErrs == nil { r.nextErrs = make(map[int]error) }
+	r.nextErrs[row] = err
+	return r
+}
+
+// Result.nextErr returns the error injected by FailNext for the given row, if any.
+func (r *Result) nextErr(row int) error {
+	r.server.lock.Lock()
+	defer r.server.lock.Unlock()
+	return r.nextErrs[row]
+}
+
+// Server.Statements returns the statements executed so far, in order.
+func (s *Server) Statements() []Statement {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Statement(nil), s.statements...)
+}
+
+// Server.Reset forgets the statements executed so far.
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.statements = nil
+}
+
+// Server.execute records a statement, and finds its result.
+func (s *Server) execute(query string, args []driver.Value) (*Result, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	statement := Statement{Query: query}
+	for _, a := range args { statement.Args = append(statement.Args, a) }
+	s.statements = append(s.statements, statement)
+
+	for i := len(s.results) - 1; i >= 0; i-- {
+		r := s.results[i]
+		if !r.pattern.MatchString(query) { continue }
+		if r.err != nil { return nil, r.err }
+		return r, nil
+	}
+	return nil, fmt.Errorf("dmltest: no result for %q", query)
+}
+
+// testDriver is the driver registered as DriverName.
+type testDriver struct{}
+
+// testDriver.Open connects to the Server with the given name.
+func (testDriver) Open(name string) (driver.Conn, error) {
+	s, ok := servers.Load(name)
+	if !ok { return nil, fmt.Errorf("dmltest: no server named %q", name) }
+	return &conn{s.(*Server)}, nil
+}
+
+// connector connects to a Server directly, for Server.DB.
+type connector struct {
+	server *Server
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{c.server}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return testDriver{}
+}
+
+// conn is a connection to a Server. Transactions are recorded as BEGIN, COMMIT and ROLLBACK
+// statements, but otherwise have no effect.
+type conn struct {
+	server *Server
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{c.server, query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	c.server.record("BEGIN")
+	return tx{c.server}, nil
+}
+
+// Server.record records a statement which has no result.
+func (s *Server) record(query string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.statements = append(s.statements, Statement{Query: query})
+}
+
+// tx is a transaction, which only records its end.
+type tx struct {
+	server *Server
+}
+
+func (t tx) Commit() error {
+	t.server.record("COMMIT")
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.server.record("ROLLBACK")
+	return nil
+}
+
+// stmt is a prepared statement, whose result is found when it is executed.
+type stmt struct {
+	server *Server
+	query  string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// stmt.NumInput returns -1, since the driver doesn't know how many placeholders queries have.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	r, err := s.server.execute(s.query, args)
+	if err != nil { return nil, err }
+	return driver.RowsAffected(r.affected), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	r, err := s.server.execute(s.query, args)
+	if err != nil { return nil, err }
+	return &rows{result: r}, nil
+}
+
+// rows iterates over a Result's data.
+type rows struct {
+	result *Result
+	row    int
+}
+
+func (r *rows) Columns() []string {
+	return r.result.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if err := r.result.nextErr(r.row); err != nil { return err }
+	if r.row >= len(r.result.data) { return io.EOF }
+	values := r.result.data[r.row]
+	if len(values) != len(dest) { return fmt.Errorf("dmltest: row %d has %d values, but there are %d columns", r.row, len(values), len(dest)) }
+	for i := range values {
+		v, err := driver.DefaultParameterConverter.ConvertValue(values[i])
+		if err != nil { return fmt.Errorf("dmltest: row %d, column %q: %w", r.row, r.result.columns[i], err) }
+		dest[i] = v
+	}
+	r.row++
+	return nil
+}
@@ -0,0 +1,121 @@
+package dmltest
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+func Test_Driver(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := NewServer()
+	defer s.Close()
+	s.Query(`(?i)^select .* from users`, []string{"id", "name", "email", "created", "score", "tags"},
+		[]interface{}{1, "alice", "a@example.com", created, 1.5, "{a,b}"},
+		[]interface{}{2, "bob", nil, created, 2.0, nil},
+	)
+	s.Query(`(?i)^select .* from users where id = \$1`, []string{"id", "name"}, []interface{}{2, "bob"})
+	s.Exec(`(?i)^update users`, 3)
+
+	db := s.DB()
+	defer db.Close()
+
+	var users []user
+	rows, err := dml.X(db.Query("SELECT * FROM users"))
+	if err != nil { t.Fatalf("Unexpected return value (Query): got %v, expected nil", err) }
+	if err := dml.ScanArray(rows, &users); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	expected := []user{
+		{1, "alice", sql.NullString{String: "a@example.com", Valid: true}, created, 1.5, []string{"a", "b"}},
+		{2, "bob", sql.NullString{}, created, 2, nil},
+	}
+	if !reflect.DeepEqual(users, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", users, expected) }
+
+	// the more specific result was added later, so it takes precedence.
+	var some []user
+	rows, err = dml.X(db.Query("select id, name from users where id = $1", 2))
+	if err != nil { t.Fatalf("Unexpected return value (Query): got %v, expected nil", err) }
+	if err := dml.ScanArray(rows, &some); err != nil || len(some) != 1 || some[0].Id != 2 || some[0].Name != "bob" { t.Errorf("Unexpected result (ScanArray): got %+v, %v", some, err) }
+
+	tx, err := db.Begin()
+	if err != nil { t.Fatalf("Unexpected return value (Begin): got %v, expected nil", err) }
+	result, err := tx.Exec("UPDATE users SET name = $1", "carol")
+	if err != nil { t.Fatalf("Unexpected return value (Exec): got %v, expected nil", err) }
+	if n, err := result.RowsAffected(); n != 3 || err != nil { t.Errorf("Unexpected return value (RowsAffected): got %d, %v, expected 3", n, err) }
+	if err := tx.Commit(); err != nil { t.Errorf("Unexpected return value (Commit): got %v, expected nil", err) }
+
+	statements := []Statement{
+		{"SELECT * FROM users", nil},
+		{"select id, name from users where id = $1", []interface{}{int64(2)}},
+		{"BEGIN", nil},
+		{"UPDATE users SET name = $1", []interface{}{"carol"}},
+		{"COMMIT", nil},
+	}
+	if got := s.Statements(); !reflect.DeepEqual(got, statements) { t.Errorf("Unexpected result (Statements): got %#v, expected %#v", got, statements) }
+	s.Reset()
+	if got := s.Statements(); len(got) != 0 { t.Errorf("Unexpected result (Statements): got %#v after Reset", got) }
+}
+
+func Test_DriverOpen(t *testing.T) {
+	s := NewServer()
+	if _, err := s.QueryStructs(`users`, []user{{Id: 7, Name: "dave"}}); err != nil { t.Fatalf("Unexpected return value (QueryStructs): got %v, expected nil", err) }
+
+	db, err := sql.Open(DriverName, s.Name())
+	if err != nil { t.Fatalf("Unexpected return value (Open): got %v, expected nil", err) }
+	defer db.Close()
+
+	var users []user
+	rows, err := dml.X(db.Query("SELECT * FROM users"))
+	if err != nil { t.Fatalf("Unexpected return value (Query): got %v, expected nil", err) }
+	if err := dml.ScanArray(rows, &users); err != nil || len(users) != 1 || users[0].Id != 7 || users[0].Name != "dave" { t.Errorf("Unexpected result (ScanArray): got %+v, %v", users, err) }
+
+	s.Close()
+	closed, _ := sql.Open(DriverName, s.Name())
+	defer closed.Close()
+	if err := closed.Ping(); err == nil || !strings.Contains(err.Error(), "no server named") { t.Errorf("Unexpected error (Ping): got %v, expected no server", err) }
+}
+
+func Test_DriverFailures(t *testing.T) {
+	boom := errors.New("boom")
+	s := NewServer()
+	defer s.Close()
+	s.Query(`users`, []string{"id", "name"}, []interface{}{1, "a"}, []interface{}{2, "b"}).FailNext(1, boom)
+	s.Fail(`^DELETE`, boom)
+	db := s.DB()
+	defer db.Close()
+
+	var users []user
+	rows, err := dml.X(db.Query("SELECT * FROM users"))
+	if err != nil { t.Fatalf("Unexpected return value (Query): got %v, expected nil", err) }
+	err = dml.ScanArray(rows, &users)
+	if err == nil { err = rows.Err() }
+	if !errors.Is(err, boom) || len(users) != 1 { t.Errorf("Unexpected result (ScanArray): got %+v, %v, expected 1 user and boom", users, err) }
+
+	if _, err := db.Exec("DELETE FROM users"); !errors.Is(err, boom) { t.Errorf("Unexpected error (Exec): got %v, expected boom", err) }
+	if _, err := db.Query("SELECT 1"); err == nil || !strings.Contains(err.Error(), `no result for "SELECT 1"`) { t.Errorf("Unexpected error (Query): got %v, expected no result", err) }
+}
+
+func Test_DriverConcurrentFailNext(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	r := s.Query(`users`, []string{"id", "name"}, []interface{}{1, "a"}, []interface{}{2, "b"})
+	db := s.DB()
+	defer db.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ { r.FailNext(10 + i, errors.New("boom")) }
+	}()
+	for i := 0; i < 100; i++ {
+		var users []user
+		rows, err := dml.X(db.Query("SELECT * FROM users"))
+		if err != nil { t.Fatalf("Unexpected return value (Query): got %v, expected nil", err) }
+		if err := dml.ScanArray(rows, &users); err != nil || len(users) != 2 { t.Fatalf("Unexpected result (ScanArray): got %+v, %v, expected 2 users", users, err) }
+	}
+	<-done
+}
@@ -0,0 +1,450 @@
+package dmltest
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+// Update makes Golden re-record its golden files instead of only reading them. It is set with the
+// -dmltest.update flag, as in go test ./mypackage -dmltest.update.
+var Update = flag.Bool("dmltest.update", false, "re-record dmltest golden files")
+
+// The golden file format is line based, so that changes to recorded results read well in a diff:
+//
+//	# comments and blank lines are ignored
+//	columns "id" "name" "created" "avatar"
+//	types "INT8" "TEXT" "TIMESTAMPTZ" "BYTEA"
+//	row 1 "alice" t"2024-01-02T03:04:05Z" NULL
+//	row 2 "bob" t"2024-01-02T03:04:05.5+01:00" b"\x89PNG"
+//	error "connection reset by peer"
+//
+// The types line, giving each column's database type name, is left out when none are known. The
+// columns (and types) lines are repeated before any row whose columns differ from the row before
+// it. Values are NULL, true, false, integers, floats (which always have a decimal point, an
+// exponent, or are NaN or ±Inf), and quoted strings, with b"..." for bytes and t"..." for times
+// in RFC 3339 format. The error line, which records the error that ended the result set, is last.
+
+// golden is a recorded result set.
+type golden struct {
+	columns [][]dml.ColumnInfo
+	rows    []goldenRow
+	err     error
+}
+
+// goldenRow is a recorded row, and the index of its columns in golden.columns.
+type goldenRow struct {
+	columns int
+	values  []driver.Value
+}
+
+// Recorder wraps an IterableScannable, and records the result set read from it, to be written to a
+// golden file and replayed later by Replay. It reads each row as Next moves to it, whether or not
+// the row is scanned, so scanning behaves exactly as it would without the Recorder; values are
+// recorded as the source produces them for *interface{}, so a Replay converts them the way
+// database/sql converts a driver's values. If a row can't be recorded, Next returns false and Err
+// returns the error.
+type Recorder struct {
+	inner    dml.IterableScannable
+	golden   golden
+	recorded bool
+	failed   error
+}
+
+// Record returns a Recorder reading from it.
+func Record(it dml.IterableScannable) *Recorder {
+	return &Recorder{inner: it}
+}
+
+// Recorder.ColumnNames returns the names of the columns of the underlying result set.
+func (r *Recorder) ColumnNames() ([]string, error) {
+	return r.inner.ColumnNames()
+}
+
+// Recorder.Columns describes the columns of the underlying result set. See dml.ColumnsOf.
+func (r *Recorder) Columns() ([]dml.ColumnInfo, error) {
+	return dml.ColumnsOf(r.inner)
+}
+
+// Recorder.ColumnsChanged reports whether the underlying result set is a
+// dml.VaryingColumnsScannable whose columns changed with the last call to Next.
+func (r *Recorder) ColumnsChanged() bool {
+	varying, ok := r.inner.(dml.VaryingColumnsScannable)
+	return ok && varying.ColumnsChanged()
+}
+
+// Recorder.Next moves to the next row, and records it.
+func (r *Recorder) Next() bool {
+	if r.failed != nil { return false }
+	// the columns are read before the first row, since *sql.Rows can't report them once it is exhausted.
+	if !r.recorded && !r.recordColumns() { return false }
+	r.recorded = true
+
+	if !r.inner.Next() {
+		r.golden.err = r.inner.Err()
+		return false
+	}
+	if r.ColumnsChanged() && !r.recordColumns() { return false }
+
+	columns := r.golden.columns[len(r.golden.columns) - 1]
+	holders := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range holders { dest[i] = &holders[i] }
+	if err := r.inner.Scan(dest...); err != nil { return r.fail(err) }
+
+	values := make([]driver.Value, len(holders))
+	for i, h := range holders {
+		v, err := driver.DefaultParameterConverter.ConvertValue(h)
+		if err != nil { return r.fail(fmt.Errorf("column %q: %w", columns[i].Name, err)) }
+		values[i] = v
+	}
+	r.golden.rows = append(r.golden.rows, goldenRow{len(r.golden.columns) - 1, values})
+	return true
+}
+
+// Recorder.recordColumns records the columns of the underlying result set.
+func (r *Recorder) recordColumns() bool {
+	columns, err := dml.ColumnsOf(r.inner)
+	if err != nil { return r.fail(err) }
+	r.golden.columns = append(r.golden.columns, columns)
+	return true
+}
+
+// Recorder.fail ends the iteration with an error recording the current row.
+func (r *Recorder) fail(err error) bool {
+	r.failed = fmt.Errorf("dmltest: recording row %d: %w", len(r.golden.rows), err)
+	return false
+}
+
+// Recorder.Scan scans the current row of the underlying result set.
+func (r *Recorder) Scan(dest ...interface{}) error {
+	return r.inner.Scan(dest...)
+}
+
+// Recorder.Err returns the error which ended the iteration, if any, which is either the error of
+// the underlying result set or an error recording it.
+func (r *Recorder) Err() error {
+	if r.failed != nil { return r.failed }
+	return r.inner.Err()
+}
+
+// Recorder.Close closes the underlying result set.
+func (r *Recorder) Close() error {
+	return r.inner.Close()
+}
+
+// Recorder.Replay returns a Replay of the rows recorded so far.
+func (r *Recorder) Replay() *Replay {
+	return &Replay{golden: r.golden, row: -1}
+}
+
+// Recorder.WriteGolden writes the rows recorded so far to w, in the golden file format.
+func (r *Recorder) WriteGolden(w io.Writer) error {
+	if r.failed != nil { return r.failed }
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# recorded by dmltest; re-record with -dmltest.update\n")
+	current := -1
+	if len(r.golden.columns) != 0 && len(r.golden.rows) == 0 { writeColumns(bw, r.golden.columns[0]) }
+	for i, row := range r.golden.rows {
+		if row.columns != current {
+			current = row.columns
+			writeColumns(bw, r.golden.columns[current])
+		}
+		bw.WriteString("row")
+		for j, v := range row.values {
+			text, err := formatValue(v)
+			if err != nil { return fmt.Errorf("dmltest: row %d, column %q: %w", i, r.golden.columns[current][j].Name, err) }
+			bw.WriteByte(' ')
+			bw.WriteString(text)
+		}
+		bw.WriteByte('\n')
+	}
+	if r.golden.err != nil { fmt.Fprintf(bw, "error %s\n", strconv.Quote(r.golden.err.Error())) }
+	return bw.Flush()
+}
+
+// Recorder.Save writes the rows recorded so far to the golden file at path, creating its directory
+// if need be.
+func (r *Recorder) Save(path string) error {
+	var buf bytes.Buffer
+	if err := r.WriteGolden(&buf); err != nil { return err }
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil { return err }
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// writeColumns writes the columns (and types, if any are known) lines.
+func writeColumns(bw *bufio.Writer, columns []dml.ColumnInfo) {
+	bw.WriteString("columns")
+	typed := false
+	for _, c := range columns {
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.Quote(c.Name))
+		typed = typed || c.DatabaseTypeName != ""
+	}
+	bw.WriteByte('\n')
+	if !typed { return }
+	bw.WriteString("types")
+	for _, c := range columns {
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.Quote(c.DatabaseTypeName))
+	}
+	bw.WriteByte('\n')
+}
+
+// formatValue renders a driver value as it is written in golden files.
+func formatValue(v driver.Value) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if math.IsInf(x, 1) { s = "+Inf" }
+		if !strings.ContainsAny(s, ".eEIN") { s += ".0" }
+		return s, nil
+	case string:
+		return strconv.Quote(x), nil
+	case []byte:
+		return "b" + strconv.Quote(string(x)), nil
+	case time.Time:
+		return "t" + strconv.Quote(x.Format(time.RFC3339Nano)), nil
+	}
+	return "", fmt.Errorf("unsupported type %T", v)
+}
+
+// Replay is a result set read from a golden file, as recorded by a Recorder. It is a
+// dml.ColumnInfoScannable, reporting the recorded names and database type names of the columns,
+// and a dml.VaryingColumnsScannable, for result sets whose rows had different columns. Values are
+// scanned as database/sql would scan them (see dml.ConvertAssign).
+type Replay struct {
+	golden golden
+	row    int
+	closed bool
+}
+
+// ReadGolden reads a Replay from r, in the golden file format.
+func ReadGolden(r io.Reader) (*Replay, error) {
+	output := &Replay{row: -1}
+	g := &output.golden
+	br := bufio.NewReader(r)
+	for number := 1; ; number++ {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF { return nil, err }
+		if perr := g.parseLine(strings.TrimSpace(line)); perr != nil { return nil, fmt.Errorf("dmltest: line %d: %w", number, perr) }
+		if err == io.EOF { break }
+	}
+	return output, nil
+}
+
+// LoadGolden reads a Replay from the golden file at path.
+func LoadGolden(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer f.Close()
+	return ReadGolden(f)
+}
+
+// golden.parseLine parses a single line of a golden file into g.
+func (g *golden) parseLine(line string) error {
+	if line == "" || strings.HasPrefix(line, "#") { return nil }
+	keyword, rest := line, ""
+	if i := strings.Index(line, " "); i >= 0 { keyword, rest = line[:i], line[i + 1:] }
+	if g.err != nil { return errors.New("unexpected data after the error") }
+	values, err := parseValues(rest)
+	if err != nil { return err }
+
+	switch keyword {
+	case "columns", "types":
+		names := make([]string, len(values))
+		for i, v := range values {
+			s, ok := v.(string)
+			if !ok { return fmt.Errorf("%s must be strings", keyword) }
+			names[i] = s
+		}
+		if keyword == "columns" {
+			columns := make([]dml.ColumnInfo, len(names))
+			for i := range names { columns[i].Name = names[i] }
+			g.columns = append(g.columns, columns)
+			return nil
+		}
+		if len(g.columns) == 0 { return errors.New("types before columns") }
+		columns := g.columns[len(g.columns) - 1]
+		if len(names) != len(columns) { return fmt.Errorf("%d types, but there are %d columns", len(names), len(columns)) }
+		for i := range names { columns[i].DatabaseTypeName = names[i] }
+	case "row":
+		if len(g.columns) == 0 { return errors.New("row before columns") }
+		if n := len(g.columns[len(g.columns) - 1]); len(values) != n { return fmt.Errorf("row has %d values, but there are %d columns", len(values), n) }
+		g.rows = append(g.rows, goldenRow{len(g.columns) - 1, values})
+	case "error":
+		if len(values) != 1 { return errors.New("error must be a single string") }
+		s, ok := values[0].(string)
+		if !ok { return errors.New("error must be a single string") }
+		g.err = errors.New(s)
+	default:
+		return fmt.Errorf("unknown line %q", keyword)
+	}
+	return nil
+}
+
+// parseValues parses the space separated values of a golden file line.
+func parseValues(line string) ([]driver.Value, error) {
+	var values []driver.Value
+	for line = strings.TrimLeft(line, " \t"); line != ""; line = strings.TrimLeft(line, " \t") {
+		var token string
+		prefix := ""
+		if strings.HasPrefix(line, `b"`) || strings.HasPrefix(line, `t"`) { prefix, line = line[:1], line[1:] }
+		if strings.HasPrefix(line, `"`) {
+			quoted, ok := quotedPrefix(line)
+			if !ok { return nil, fmt.Errorf("invalid string %s", line) }
+			token, line = quoted, line[len(quoted):]
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 { end = len(line) }
+			token, line = line[:end], line[end:]
+		}
+
+		v, err := parseValue(prefix, token)
+		if err != nil { return nil, err }
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// quotedPrefix returns the double quoted string at the start of line, up to and including its
+// closing quote, reporting false if it isn't closed.
+func quotedPrefix(line string) (string, bool) {
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return line[:i + 1], true
+		}
+	}
+	return "", false
+}
+
+// parseValue parses a single value, with its b or t prefix, if any.
+func parseValue(prefix, token string) (driver.Value, error) {
+	if strings.HasPrefix(token, `"`) {
+		s, err := strconv.Unquote(token)
+		if err != nil { return nil, fmt.Errorf("invalid string %s", token) }
+		switch prefix {
+		case "b":
+			return []byte(s), nil
+		case "t":
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil { return nil, err }
+			return t, nil
+		}
+		return s, nil
+	}
+
+	switch token {
+	case "NULL":
+		return nil, nil
+	case "true", "false":
+		return token == "true", nil
+	}
+	if i, err := strconv.ParseInt(token, 10, 64); err == nil { return i, nil }
+	if f, err := strconv.ParseFloat(token, 64); err == nil { return f, nil }
+	return nil, fmt.Errorf("invalid value %q", token)
+}
+
+// Replay.current returns the columns of the current row, or before the first row, of the first.
+func (r *Replay) current() []dml.ColumnInfo {
+	if r.row >= 0 && r.row < len(r.golden.rows) { return r.golden.columns[r.golden.rows[r.row].columns] }
+	if len(r.golden.columns) == 0 { return nil }
+	return r.golden.columns[0]
+}
+
+// Replay.Columns describes the columns of the current row.
+func (r *Replay) Columns() ([]dml.ColumnInfo, error) {
+	if r.closed { return nil, errors.New("sql: Rows are closed") }
+	return r.current(), nil
+}
+
+// Replay.ColumnNames returns the names of the columns of the current row.
+func (r *Replay) ColumnNames() ([]string, error) {
+	if r.closed { return nil, errors.New("sql: Rows are closed") }
+	columns := r.current()
+	if columns == nil { return nil, nil }
+	names := make([]string, len(columns))
+	for i := range columns { names[i] = columns[i].Name }
+	return names, nil
+}
+
+// Replay.ColumnsChanged reports whether the current row has different columns to the one before it.
+func (r *Replay) ColumnsChanged() bool {
+	return r.row > 0 && r.row < len(r.golden.rows) && r.golden.rows[r.row].columns != r.golden.rows[r.row - 1].columns
+}
+
+// Replay.Next moves to the next row, returning false (and closing the result set) at the end.
+func (r *Replay) Next() bool {
+	if r.closed { return false }
+	r.row++
+	if r.row >= len(r.golden.rows) {
+		r.closed = true
+		return false
+	}
+	return true
+}
+
+// Replay.Err returns the recorded error which ended the result set, once Next has reached it.
+func (r *Replay) Err() error {
+	if r.row < len(r.golden.rows) { return nil }
+	return r.golden.err
+}
+
+// Replay.Close closes the result set. It can be called more than once.
+func (r *Replay) Close() error {
+	r.closed = true
+	return nil
+}
+
+// Replay.Scan stores the values of the current row into dest, one per column.
+func (r *Replay) Scan(dest ...interface{}) error {
+	if r.closed { return errors.New("sql: Rows are closed") }
+	if r.row < 0 { return errors.New("sql: Scan called without calling Next") }
+	row := r.golden.rows[r.row]
+	if len(dest) != len(row.values) { return fmt.Errorf("sql: expected %d destination arguments in Scan, not %d", len(row.values), len(dest)) }
+	for i, d := range dest {
+		if err := dml.ConvertAssign(d, row.values[i]); err != nil { return fmt.Errorf("sql: Scan error on column index %d, name %q: %w", i, r.golden.columns[row.columns][i].Name, err) }
+	}
+	return nil
+}
+
+// Golden returns a Replay of the result set in the golden file at path. With -dmltest.update (see
+// Update), it first calls query, and records the whole result set it returns to path, so that
+// tests can be run once against a real database and replayed without one afterwards.
+func Golden(tb testing.TB, path string, query func() (dml.IterableScannable, error)) *Replay {
+	tb.Helper()
+	if *Update {
+		it, err := query()
+		if err != nil { tb.Fatalf("dmltest: recording %s: %v", path, err) }
+		recorder := Record(it)
+		for recorder.Next() {}
+		it.Close()
+		if err := recorder.Save(path); err != nil { tb.Fatalf("dmltest: recording %s: %v", path, err) }
+	}
+
+	replay, err := LoadGolden(path)
+	if err != nil { tb.Fatalf("dmltest: replaying %s: %v (record it with -dmltest.update)", path, err) }
+	return replay
+}
@@ -0,0 +1,133 @@
+package dmltest
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+func Test_RecordReplay(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 500, time.UTC)
+	s := NewServer()
+	defer s.Close()
+	s.Query(`users`, []string{"id", "name", "email", "created", "score", "tags"},
+		[]interface{}{1, "alice", "a@example.com", created, 1.5, []byte("{a,b}")},
+		[]interface{}{2, "bob \"b\"\n", nil, created, 2.0, nil},
+	).FailNext(2, errors.New("connection reset"))
+	db := s.DB()
+	defer db.Close()
+
+	rows, err := dml.X(db.Query("SELECT * FROM users"))
+	if err != nil { t.Fatalf("Unexpected return value (Query): got %v, expected nil", err) }
+	recorder := Record(rows)
+	var users []user
+	err = dml.ScanArray(recorder, &users)
+	if err == nil { err = recorder.Err() }
+	if err == nil || err.Error() != "connection reset" || len(users) != 2 { t.Fatalf("Unexpected result (ScanArray, Record): got %+v, %v", users, err) }
+
+	var buf bytes.Buffer
+	if err := recorder.WriteGolden(&buf); err != nil { t.Fatalf("Unexpected return value (WriteGolden): got %v, expected nil", err) }
+	expected := `# recorded by dmltest; re-record with -dmltest.update
+columns "id" "name" "email" "created" "score" "tags"
+row 1 "alice" "a@example.com" t"2024-01-02T03:04:05.0000005Z" 1.5 b"{a,b}"
+row 2 "bob \"b\"\n" NULL t"2024-01-02T03:04:05.0000005Z" 2.0 NULL
+error "connection reset"
+`
+	if buf.String() != expected { t.Errorf("Unexpected result (WriteGolden): got\n%s\nexpected\n%s", buf.String(), expected) }
+
+	for name, replay := range map[string]func() (*Replay, error){
+		"recorder": func() (*Replay, error) { return recorder.Replay(), nil },
+		"golden":   func() (*Replay, error) { return ReadGolden(strings.NewReader(buf.String())) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := replay()
+			if err != nil { t.Fatalf("Unexpected return value (ReadGolden): got %v, expected nil", err) }
+			var replayed []user
+			err = dml.ScanArray(r, &replayed)
+			if err == nil { err = r.Err() }
+			if err == nil || err.Error() != "connection reset" || !reflect.DeepEqual(replayed, users) { t.Errorf("Unexpected result (ScanArray, Replay): got %+v, %v, expected %+v", replayed, err, users) }
+		})
+	}
+}
+
+func Test_ReadGolden(t *testing.T) {
+	r, err := ReadGolden(strings.NewReader(`
+# a comment
+columns "id" "score"
+types "INT8" "FLOAT8"
+row 1 NaN
+row -2 1e+21
+columns "name" "ok"
+row "x y" true
+`))
+	if err != nil { t.Fatalf("Unexpected return value (ReadGolden): got %v, expected nil", err) }
+
+	columns, err := r.Columns()
+	expected := []dml.ColumnInfo{{Name: "id", DatabaseTypeName: "INT8"}, {Name: "score", DatabaseTypeName: "FLOAT8"}}
+	if err != nil || !reflect.DeepEqual(columns, expected) { t.Errorf("Unexpected return value (Columns): got %+v, %v", columns, err) }
+
+	var id int64
+	var score float64
+	if !r.Next() || r.ColumnsChanged() { t.Fatalf("Expected a first row with the same columns") }
+	if err := r.Scan(&id, &score); err != nil || id != 1 || !math.IsNaN(score) { t.Errorf("Unexpected result (Scan): got %d, %v, %v", id, score, err) }
+	if !r.Next() || r.ColumnsChanged() { t.Fatalf("Expected a second row with the same columns") }
+	if err := r.Scan(&id, &score); err != nil || id != -2 || score != 1e21 { t.Errorf("Unexpected result (Scan): got %d, %v, %v", id, score, err) }
+
+	var name sql.NullString
+	var ok bool
+	if !r.Next() || !r.ColumnsChanged() { t.Fatalf("Expected a third row with different columns") }
+	if names, err := r.ColumnNames(); err != nil || !reflect.DeepEqual(names, []string{"name", "ok"}) { t.Errorf("Unexpected return value (ColumnNames): got %v, %v", names, err) }
+	if err := r.Scan(&name, &ok); err != nil || name.String != "x y" || !ok { t.Errorf("Unexpected result (Scan): got %v, %v, %v", name, ok, err) }
+	if r.Next() || r.Err() != nil { t.Errorf("Expected the end of the result set, got %v", r.Err()) }
+
+	testcases := map[string]struct{
+		data string
+		err string
+	}{
+		"row first":  {`row 1`, "line 1: row before columns"},
+		"width":      {"columns \"a\"\nrow 1 2", "line 2: row has 2 values, but there are 1 columns"},
+		"types":      {"columns \"a\"\ntypes \"INT8\" \"TEXT\"", "line 2: 2 types, but there are 1 columns"},
+		"value":      {"columns \"a\"\nrow one", `line 2: invalid value "one"`},
+		"string":     {"columns \"a\"\nrow \"one", "line 2: invalid string"},
+		"time":       {"columns \"a\"\nrow t\"yesterday\"", "line 2: parsing time"},
+		"after":      {"columns \"a\"\nerror \"x\"\nrow 1", "line 3: unexpected data after the error"},
+		"keyword":    {"rows 1", `line 1: unknown line "rows"`},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			_, err := ReadGolden(strings.NewReader(v.data))
+			if err == nil || !strings.Contains(err.Error(), v.err) { t.Errorf("Unexpected error: got %v, expected %q", err, v.err) }
+		})
+	}
+}
+
+func Test_Golden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "users.golden")
+	query := func() (dml.IterableScannable, error) {
+		return NewRows([]string{"id", "name"}, []interface{}{1, "alice"}, []interface{}{2, "bob"}), nil
+	}
+
+	defer func(update bool) { *Update = update }(*Update)
+	*Update = true
+	var users []user
+	if err := dml.ScanArray(Golden(t, path, query), &users); err != nil || len(users) != 2 || users[1].Name != "bob" { t.Fatalf("Unexpected result (Golden, update): got %+v, %v", users, err) }
+
+	*Update = false
+	users = nil
+	if err := dml.ScanArray(Golden(t, path, nil), &users); err != nil || len(users) != 2 || users[0].Name != "alice" { t.Errorf("Unexpected result (Golden): got %+v, %v", users, err) }
+
+	// a row which can't be recorded fails the recording, rather than being left out.
+	recorder := Record(NewRows([]string{"id"}, []interface{}{1}, []interface{}{"x"}).FailScan(1, 0, errors.New("boom")))
+	for recorder.Next() {}
+	if err := recorder.Err(); err == nil || err.Error() != "dmltest: recording row 1: sql: Scan error on column index 0, name \"id\": boom" { t.Errorf("Unexpected error (Record): got %v", err) }
+	if err := recorder.WriteGolden(&bytes.Buffer{}); err == nil { t.Errorf("Expected an error writing a failed recording") }
+}
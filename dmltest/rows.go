@@ -0,0 +1,143 @@
+// Package dmltest provides fakes for testing code which scans with dml without a database: Rows,
+// an in-memory result set, a database/sql driver which serves canned results (see Server), and
+// golden files of recorded results (see Golden).
+package dmltest
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/thewug/dml"
+)
+
+// Rows is an in-memory result set, which behaves like *sql.Rows (as adapted by dml.X): values are
+// converted as a driver would convert them (see driver.DefaultParameterConverter), and then
+// stored as database/sql would store them (see dml.ConvertAssign), so tests see the same
+// conversions and errors that they would with a real database. Errors can be injected with FailNext,
+// FailScan and FailColumns.
+type Rows struct {
+	columns []string
+	data    [][]interface{}
+	row     int
+	closed  bool
+	err     error
+
+	columnsErr error
+	nextErrs   map[int]error
+	scanErrs   map[[2]int]error
+}
+
+// NewRows returns Rows with the given columns and data, one slice of values per row.
+func NewRows(columns []string, data ...[]interface{}) *Rows {
+	return &Rows{columns: columns, data: data, row: -1}
+}
+
+// FromStructs returns Rows holding the values of rows, a slice of (or pointer to a slice of)
+// structs or pointers to structs, with the columns they are scanned from. See dml.ColumnValues.
+func FromStructs(rows interface{}) (*Rows, error) {
+	v := reflect.ValueOf(rows)
+	for v.Kind() == reflect.Ptr && !v.IsNil() { v = v.Elem() }
+	if v.Kind() != reflect.Slice { return nil, fmt.Errorf("dmltest: %T is not a slice", rows) }
+
+	t := v.Type().Elem()
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+	columns, _, err := dml.ColumnValues(reflect.New(t).Interface())
+	if err != nil { return nil, err }
+
+	output := NewRows(columns)
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		if e.Kind() == reflect.Ptr && e.IsNil() { return nil, fmt.Errorf("dmltest: row %d is nil", i) }
+		if e.Kind() != reflect.Ptr { e = e.Addr() }
+		_, values, err := dml.ColumnValues(e.Interface())
+		if err != nil { return nil, fmt.Errorf("dmltest: row %d: %w", i, err) }
+		row := make([]interface{}, len(values))
+		for j := range values { row[j] = values[j] }
+		output.data = append(output.data, row)
+	}
+	return output, nil
+}
+
+// Rows.FailColumns makes ColumnNames return err.
+func (r *Rows) FailColumns(err error) *Rows {
+	r.columnsErr = err
+	return r
+}
+
+// Rows.FailNext makes Next return false instead of moving to the row with the given index (counting
+// from 0), and Err return err, as if the connection had failed while reading it.
+func (r *Rows) FailNext(row int, err error) *Rows {
+	if r.nextErrs == nil { r.nextErrs = make(map[int]error) }
+	r.nextErrs[row] = err
+	return r
+}
+
+// Rows.FailScan makes Scan return err, the way *sql.Rows reports conversion errors, when it
+// reaches the given column of the row with the given index (counting from 0).
+func (r *Rows) FailScan(row, column int, err error) *Rows {
+	if r.scanErrs == nil { r.scanErrs = make(map[[2]int]error) }
+	r.scanErrs[[2]int{row, column}] = err
+	return r
+}
+
+// Rows.ColumnNames returns the names of the columns.
+func (r *Rows) ColumnNames() ([]string, error) {
+	if r.closed { return nil, errors.New("sql: Rows are closed") }
+	if r.columnsErr != nil { return nil, r.columnsErr }
+	return r.columns, nil
+}
+
+// Rows.Next moves to the next row, returning false (and closing the rows) at the end of the data,
+// or if the row has an error injected by FailNext.
+func (r *Rows) Next() bool {
+	if r.closed { return false }
+	if err := r.nextErrs[r.row + 1]; err != nil {
+		r.err = err
+		r.closed = true
+		return false
+	}
+	r.row++
+	if r.row >= len(r.data) {
+		r.closed = true
+		return false
+	}
+	return true
+}
+
+// Rows.Err returns the error which ended the iteration, if any.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Rows.Close closes the rows. It can be called more than once.
+func (r *Rows) Close() error {
+	r.closed = true
+	return nil
+}
+
+// Rows.Closed reports whether the rows have been closed, either by Close or by reaching the end.
+func (r *Rows) Closed() bool {
+	return r.closed
+}
+
+// Rows.Scan stores the values of the current row into dest, one per column.
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.closed { return errors.New("sql: Rows are closed") }
+	if r.row < 0 { return errors.New("sql: Scan called without calling Next") }
+	values := r.data[r.row]
+	if len(values) != len(r.columns) { return fmt.Errorf("dmltest: row %d has %d values, but there are %d columns", r.row, len(values), len(r.columns)) }
+	if len(dest) != len(values) { return fmt.Errorf("sql: expected %d destination arguments in Scan, not %d", len(values), len(dest)) }
+
+	for i, d := range dest {
+		err := r.scanErrs[[2]int{r.row, i}]
+		if err == nil {
+			var value driver.Value
+			value, err = driver.DefaultParameterConverter.ConvertValue(values[i])
+			if err == nil { err = dml.ConvertAssign(d, value) }
+		}
+		if err != nil { return fmt.Errorf("sql: Scan error on column index %d, name %q: %w", i, r.columns[i], err) }
+	}
+	return nil
+}
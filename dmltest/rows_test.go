@@ -0,0 +1,73 @@
+package dmltest
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+type user struct {
+	Id      int64          `dml:"id"`
+	Name    string         `dml:"name"`
+	Email   sql.NullString `dml:"email"`
+	Created time.Time      `dml:"created"`
+	Score   float32        `dml:"score"`
+	Tags    []string       `dml:"tags,array"`
+}
+
+func Test_Rows(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := NewRows([]string{"name", "id", "email", "created", "score", "tags"},
+		[]interface{}{"alice", 1, "a@example.com", created, 1.5, "{a,b}"},
+		[]interface{}{[]byte("bob"), "2", nil, created, "2", nil},
+	)
+
+	var users []user
+	if err := dml.ScanArray(rows, &users); err != nil || rows.Err() != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, %v", err, rows.Err()) }
+	expected := []user{
+		{1, "alice", sql.NullString{String: "a@example.com", Valid: true}, created, 1.5, []string{"a", "b"}},
+		{2, "bob", sql.NullString{}, created, 2, nil},
+	}
+	if !reflect.DeepEqual(users, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", users, expected) }
+	if !rows.Closed() || rows.Next() { t.Errorf("Expected the rows to be closed at the end") }
+	if err := rows.Scan(new(string)); err == nil { t.Errorf("Expected an error scanning closed rows") }
+
+	again, err := FromStructs(users)
+	if err != nil { t.Fatalf("Unexpected return value (FromStructs): got %v, expected nil", err) }
+	var copies []user
+	if err := dml.ScanArray(again, &copies); err != nil || !reflect.DeepEqual(copies, users) { t.Errorf("Unexpected result (ScanArray, FromStructs): got %+v, %v", copies, err) }
+	if _, err := FromStructs([]*user{nil}); err == nil { t.Errorf("Expected an error for a nil row") }
+}
+
+func Test_Failures(t *testing.T) {
+	boom := errors.New("boom")
+	data := [][]interface{}{{1, "a"}, {2, "b"}, {3, "c"}}
+
+	testcases := map[string]struct{
+		rows *Rows
+		scanned int
+		err string
+	}{
+		"columns": {NewRows([]string{"id", "name"}, data...).FailColumns(boom), 0, "boom"},
+		"next":    {NewRows([]string{"id", "name"}, data...).FailNext(2, boom), 2, "boom"},
+		"scan":    {NewRows([]string{"id", "name"}, data...).FailScan(1, 1, boom), 1, `sql: Scan error on column index 1, name "name": boom`},
+		"convert": {NewRows([]string{"id", "name"}, []interface{}{"x", "a"}), 0, `sql: Scan error on column index 0, name "id": converting string ("x") to a int64`},
+		"driver":  {NewRows([]string{"id", "name"}, []interface{}{struct{}{}, "a"}), 0, "unsupported type struct {}"},
+		"width":   {NewRows([]string{"id", "name"}, []interface{}{1}), 0, "row 0 has 1 values, but there are 2 columns"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			var users []user
+			err := dml.ScanArray(v.rows, &users)
+			if err == nil { err = v.rows.Err() }
+			if err == nil || !strings.Contains(err.Error(), v.err) { t.Errorf("Unexpected error: got %v, expected %q", err, v.err) }
+			if len(users) != v.scanned { t.Errorf("Unexpected result: got %d users, expected %d", len(users), v.scanned) }
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// dmlvet checks the select lists of SQL queries against the `dml` tags of the structs their
+// results are scanned into. See the dmlvet package for details. It is installed from the dmlvet
+// directory of a checkout of dml, whose dml package it is built against, and run by go vet:
+//
+//     (cd path/to/dml/dmlvet && go install ./cmd/dmlvet)
+//     go vet -vettool=$(which dmlvet) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/unitchecker"
+
+	"github.com/thewug/dml/dmlvet"
+)
+
+func main() { unitchecker.Main(dmlvet.Analyzer) }
@@ -0,0 +1,270 @@
+// Package dmlvet provides an analyzer which checks the select lists of SQL queries against the
+// `dml` tags of the structs their results are scanned into.
+//
+// For each call to dml.Scan, dml.ScanArray or dml.QuickScan, the analyzer looks for the query
+// which produced the rows being scanned: either a call with a constant string argument passed
+// directly to the scan, or the most recent assignment of the rows variable in the same function.
+// If it finds one, it parses the SELECT list and reports columns which no field is tagged with,
+// and tagged fields which are never selected, noting which of those are required. For QuickScan,
+// which maps columns by position, it reports mismatches in count and order instead.
+//
+// Queries selecting a wildcard, and structs which implement NoDefaults, can't be checked and are
+// skipped. For structs with their own GetFields, unused columns aren't reported, since they may
+// be claimed by fields which can't be seen statically.
+package dmlvet
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+
+	"github.com/thewug/dml/internal/structcols"
+)
+
+// dmlPath is the import path of the package whose calls are checked.
+const dmlPath = "github.com/thewug/dml"
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "dmlvet",
+	Doc:      "check SQL select lists against the dml tags of the structs they are scanned into",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// destination is the statically known information about the objects passed to a scan.
+type destination struct {
+	names    []string // type names, for messages
+	tags     []string // tagged column names, in field order
+	fields   []string // the field name path of each tag, for messages
+	required []bool   // whether each tag is required, so that scanning fails if it isn't selected
+	partial  bool     // true if some fields are supplied by GetFields and can't be seen
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push { return true }
+		call := n.(*ast.CallExpr)
+		name := dmlFunction(pass, call)
+		if name == "" || len(call.Args) < 2 { return true }
+
+		query, ok := findQuery(pass, call.Args[0], call, stack)
+		if !ok { return true }
+		columns, ok := selectColumns(query)
+		if !ok { return true }
+		dest, ok := destinations(pass, call.Args[1:], name == "ScanArray")
+		if !ok { return true }
+
+		if name == "QuickScan" {
+			checkPositional(pass, call, columns, dest)
+		} else {
+			checkNamed(pass, call, columns, dest)
+		}
+		return true
+	})
+
+	return nil, nil
+}
+
+// dmlFunction returns the name of the dml function called by call, if it is one which is checked.
+func dmlFunction(pass *analysis.Pass, call *ast.CallExpr) string {
+	var ident *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	case *ast.Ident:
+		ident = fun
+	default:
+		return ""
+	}
+
+	fn, ok := pass.TypesInfo.Uses[ident].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != dmlPath { return "" }
+	switch fn.Name() {
+	case "Scan", "ScanArray", "QuickScan":
+		return fn.Name()
+	}
+	return ""
+}
+
+// constantString returns the value of expr if it is a constant string.
+func constantString(pass *analysis.Pass, expr ast.Expr) (string, bool) {
+	tv, ok := pass.TypesInfo.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String { return "", false }
+	return constant.StringVal(tv.Value), true
+}
+
+// queryIn looks for the first constant string passed to a call in expr, searching nested calls
+// so that both db.Query("...") and dml.X(db.Query("...")) are understood.
+func queryIn(pass *analysis.Pass, expr ast.Expr) (string, bool) {
+	call, ok := unparen(expr).(*ast.CallExpr)
+	if !ok { return "", false }
+	for _, arg := range call.Args {
+		if s, ok := constantString(pass, arg); ok { return s, true }
+	}
+	for _, arg := range call.Args {
+		if s, ok := queryIn(pass, arg); ok { return s, true }
+	}
+	return "", false
+}
+
+// findQuery finds the query which produced rows, either inline or in the most recent assignment
+// to the variable rows, before the scan call, within the function enclosing it.
+func findQuery(pass *analysis.Pass, rows ast.Expr, call *ast.CallExpr, stack []ast.Node) (string, bool) {
+	if s, ok := queryIn(pass, rows); ok { return s, true }
+
+	ident, ok := unparen(rows).(*ast.Ident)
+	if !ok { return "", false }
+	obj := pass.TypesInfo.ObjectOf(ident)
+	if obj == nil { return "", false }
+
+	var body ast.Node
+	for i := len(stack) - 1; i >= 0 && body == nil; i-- {
+		switch f := stack[i].(type) {
+		case *ast.FuncDecl:
+			body = f.Body
+		case *ast.FuncLit:
+			body = f.Body
+		}
+	}
+	if body == nil { return "", false }
+
+	var found ast.Expr
+	var foundPos token.Pos
+	assigned := func(lhs []ast.Expr, rhs []ast.Expr, pos token.Pos) {
+		if pos >= call.Pos() || pos < foundPos { return }
+		for i, l := range lhs {
+			if id, ok := l.(*ast.Ident); !ok || pass.TypesInfo.ObjectOf(id) != obj { continue }
+			if len(rhs) == len(lhs) {
+				found = rhs[i]
+			} else if len(rhs) == 1 {
+				found = rhs[0]
+			}
+			foundPos = pos
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.AssignStmt:
+			assigned(s.Lhs, s.Rhs, s.Pos())
+		case *ast.ValueSpec:
+			lhs := make([]ast.Expr, len(s.Names))
+			for i := range s.Names { lhs[i] = s.Names[i] }
+			assigned(lhs, s.Values, s.Pos())
+		}
+		return true
+	})
+
+	if found == nil { return "", false }
+	return queryIn(pass, found)
+}
+
+// destinations collects the tagged columns of the structs passed as scan destinations. If array is
+// true, they are pointers to slices. It returns false if any of them can't be examined statically.
+func destinations(pass *analysis.Pass, args []ast.Expr, array bool) (output destination, ok bool) {
+	for _, arg := range args {
+		t := pass.TypesInfo.TypeOf(arg)
+		if t == nil { return output, false }
+		t = deref(t)
+		if array {
+			slice, ok := t.Underlying().(*types.Slice)
+			if !ok { return output, false }
+			t = deref(slice.Elem())
+		}
+
+		s, ok := t.Underlying().(*types.Struct)
+		if !ok || structcols.HasMethod(t, "NoDefaults") { return output, false }
+		if structcols.HasMethod(t, "GetFields") { output.partial = true }
+
+		name := types.TypeString(t, types.RelativeTo(pass.Pkg))
+		output.names = append(output.names, name)
+		columns, err := structcols.Columns(s)
+		if err != nil { return output, false }
+		for _, c := range columns {
+			output.tags = append(output.tags, c.Tag.Name)
+			output.fields = append(output.fields, name + "." + strings.Join(c.Path, "."))
+			output.required = append(output.required, c.Tag.Required)
+		}
+	}
+
+	return output, true
+}
+
+// unparen strips any number of parentheses from expr.
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok { return expr }
+		expr = p.X
+	}
+}
+
+// deref strips any number of pointers from t.
+func deref(t types.Type) types.Type {
+	for {
+		p, ok := t.Underlying().(*types.Pointer)
+		if !ok { return t }
+		t = p.Elem()
+	}
+}
+
+// checkNamed reports columns with no matching tag, and tags with no matching column. Missing columns
+// of required fields are reported as such, since scanning fails on them, as it does in checkRequired.
+func checkNamed(pass *analysis.Pass, call *ast.CallExpr, columns []string, dest destination) {
+	selected := make(map[string]bool)
+	for _, c := range columns { selected[c] = true }
+	tagged := make(map[string]bool)
+	for _, t := range dest.tags {
+		for _, alias := range strings.Split(t, "|") { tagged[alias] = true }
+	}
+
+	// a column whose name can't be determined might be any of the tags.
+	unknown := selected[""]
+
+	if !dest.partial {
+		for _, c := range columns {
+			if c != "" && !tagged[c] {
+				pass.Reportf(call.Pos(), "column %q is selected but no field of %s is tagged with it", c, strings.Join(dest.names, ", "))
+			}
+		}
+	}
+	if !unknown {
+		for i, t := range dest.tags {
+			if anySelected(selected, t) { continue }
+			if dest.required[i] {
+				pass.Reportf(call.Pos(), "field %s is required, but its column %q is never selected", dest.fields[i], t)
+			} else {
+				pass.Reportf(call.Pos(), "field %s is tagged %q, which is never selected", dest.fields[i], t)
+			}
+		}
+	}
+}
+
+// anySelected reports whether any of the |-separated aliases in tag is selected.
+func anySelected(selected map[string]bool, tag string) bool {
+	for _, alias := range strings.Split(tag, "|") {
+		if selected[alias] { return true }
+	}
+	return false
+}
+
+// checkPositional reports mismatches between columns and tags, which QuickScan pairs up in order.
+func checkPositional(pass *analysis.Pass, call *ast.CallExpr, columns []string, dest destination) {
+	if dest.partial { return }
+	if len(columns) != len(dest.tags) {
+		pass.Reportf(call.Pos(), "query selects %d columns, but %s has %d tagged fields", len(columns), strings.Join(dest.names, ", "), len(dest.tags))
+		return
+	}
+	for i := range columns {
+		if columns[i] != "" && !anySelected(map[string]bool{columns[i]: true}, dest.tags[i]) {
+			pass.Reportf(call.Pos(), "column %d is %q, but scans into field %s, which is tagged %q", i + 1, columns[i], dest.fields[i], dest.tags[i])
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package dmlvet
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func Test_Analyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "a")
+}
+
+func Test_selectColumns(t *testing.T) {
+	testcases := map[string]struct{
+		query string
+		columns []string
+		ok bool
+	}{
+		"simple":     {"SELECT a, b, c FROM t", []string{"a", "b", "c"}, true},
+		"lowercase":  {"select a,b from t where c = 1", []string{"a", "b"}, true},
+		"qualified":  {"SELECT t.a, s.\"B\" FROM t, s", []string{"a", "B"}, true},
+		"alias":      {"SELECT a AS x, f(b, c) AS \"Y\", 1 + 2 z FROM t", []string{"x", "Y", "z"}, true},
+		"expression": {"SELECT a + b, count(*), c::text FROM t", []string{"", "", "c"}, true},
+		"distinct":   {"SELECT DISTINCT ON (a) a, b FROM t", []string{"a", "b"}, true},
+		"subquery":   {"SELECT (SELECT max(x) FROM u) AS m, 'a, b' AS s FROM t", []string{"m", "s"}, true},
+		"cte":        {"WITH q AS (SELECT x FROM u) SELECT a FROM q", []string{"a"}, true},
+		"no-from":    {"SELECT 1 AS one;", []string{"one"}, true},
+		"wildcard":   {"SELECT a, t.* FROM t", nil, false},
+		"star":       {"SELECT * FROM t", nil, false},
+		"not-select": {"UPDATE t SET a = 1", nil, false},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			columns, ok := selectColumns(v.query)
+			if ok != v.ok { t.Errorf("Unexpected return value (selectColumns): got %v, expected %v", ok, v.ok) }
+			if !reflect.DeepEqual(columns, v.columns) { t.Errorf("Unexpected return value (selectColumns): got %q, expected %q", columns, v.columns) }
+		})
+	}
+}
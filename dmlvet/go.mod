@@ -0,0 +1,16 @@
+module github.com/thewug/dml/dmlvet
+
+go 1.22.0
+
+require (
+	github.com/thewug/dml v0.0.0
+	golang.org/x/tools v0.28.0
+)
+
+require (
+	golang.org/x/mod v0.22.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+)
+
+// dmlvet is built against the dml in the same checkout; see the README.
+replace github.com/thewug/dml => ../
@@ -0,0 +1,118 @@
+package dmlvet
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitTop splits s at each rune for which sep returns true, ignoring any which appear inside
+// parentheses or quotes. Empty pieces are dropped.
+func splitTop(s string, sep func(rune) bool) (output []string) {
+	depth := 0
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote { quote = 0 }
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			depth--
+		case depth == 0 && sep(r):
+			if piece := strings.TrimSpace(s[start:i]); piece != "" { output = append(output, piece) }
+			start = i + len(string(r))
+		}
+	}
+	if piece := strings.TrimSpace(s[start:]); piece != "" { output = append(output, piece) }
+	return output
+}
+
+// isIdentRune reports whether r can appear in an unquoted SQL identifier.
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isIdent reports whether s is a single, possibly quoted, SQL identifier.
+func isIdent(s string) bool {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '`' && s[len(s)-1] == '`') { return true }
+	if s == "" || unicode.IsDigit(rune(s[0])) { return false }
+	for _, r := range s {
+		if !isIdentRune(r) { return false }
+	}
+	return true
+}
+
+// unquote removes the quotes from a quoted identifier.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '`' && s[len(s)-1] == '`') { return s[1:len(s)-1] }
+	return s
+}
+
+// clauseEnds are the keywords which end a select list.
+var clauseEnds = map[string]bool{"from": true, "into": true, "where": true, "union": true, "intersect": true, "except": true, "group": true, "order": true, "limit": true, "having": true, "window": true}
+
+// selectList returns the raw entries of the select list of the outermost SELECT in query.
+func selectList(query string) ([]string, bool) {
+	words := splitTop(strings.TrimSpace(query), func(r rune) bool { return unicode.IsSpace(r) || r == ';' })
+	begin := -1
+	for i, w := range words {
+		if strings.EqualFold(w, "select") {
+			begin = i + 1
+			break
+		}
+	}
+	if begin == -1 { return nil, false }
+
+	for begin < len(words) && (strings.EqualFold(words[begin], "distinct") || strings.EqualFold(words[begin], "all")) {
+		begin++
+		// skip postgres' DISTINCT ON (...)
+		if begin + 1 < len(words) && strings.EqualFold(words[begin], "on") && strings.HasPrefix(words[begin+1], "(") { begin += 2 }
+	}
+
+	end := begin
+	for end < len(words) && !clauseEnds[strings.ToLower(words[end])] { end++ }
+
+	return splitTop(strings.Join(words[begin:end], " "), func(r rune) bool { return r == ',' }), true
+}
+
+// columnName works out the name a database will give to a single select list entry. It returns
+// "" if the name can't be determined statically, and false if the entry is a wildcard.
+func columnName(entry string) (string, bool) {
+	tokens := splitTop(entry, unicode.IsSpace)
+	last := tokens[len(tokens)-1]
+
+	if len(tokens) >= 3 && strings.EqualFold(tokens[len(tokens)-2], "as") { return unquote(last), true }
+	if len(tokens) >= 2 && isIdent(last) {
+		prev := []rune(tokens[len(tokens)-2])
+		if r := prev[len(prev)-1]; isIdentRune(r) || r == ')' || r == '"' || r == '\'' { return unquote(last), true }
+	}
+	if len(tokens) != 1 { return "", true }
+
+	expr := last
+	if i := strings.Index(expr, "::"); i != -1 { expr = expr[:i] }
+	parts := splitTop(expr, func(r rune) bool { return r == '.' })
+	if len(parts) == 0 { return "", true }
+	name := parts[len(parts)-1]
+	if name == "*" { return "", false }
+	if isIdent(name) { return unquote(name), true }
+	return "", true
+}
+
+// selectColumns returns the names of the columns the outermost SELECT in query will return. Names
+// which can't be determined statically are "". It returns false if query isn't a SELECT, or if it
+// selects a wildcard, since the columns then aren't knowable without the database schema.
+func selectColumns(query string) ([]string, bool) {
+	entries, ok := selectList(query)
+	if !ok || len(entries) == 0 { return nil, false }
+
+	var output []string
+	for _, e := range entries {
+		name, ok := columnName(e)
+		if !ok { return nil, false }
+		output = append(output, name)
+	}
+	return output, true
+}
@@ -0,0 +1,118 @@
+package a
+
+import (
+	"github.com/thewug/dml"
+)
+
+type DB struct{}
+
+func (db *DB) Query(query string, args ...interface{}) (dml.Scannable, error) { return nil, nil }
+func (db *DB) QueryRow(query string, args ...interface{}) dml.Scannable       { return nil }
+
+type Audit struct {
+	CreatedBy int64 `dml:"created_by"`
+}
+
+type User struct {
+	Audit
+
+	Id   int64  `dml:"id"`
+	Name string `dml:"name"`
+}
+
+type Login struct {
+	Username string `dml:"username|user_name"`
+}
+
+type Custom struct {
+	Id int64 `dml:"id"`
+}
+
+type Profile struct {
+	Id       int64  `dml:"id,required"`
+	Bio      string `dml:"bio"`
+	Theme    string `dml:"theme,default=light"`
+	Language string `dml:"language,default=en"`
+}
+
+func (c *Custom) GetFields() (dml.NamedFields, error) { return dml.NamedFields{}, nil }
+
+type Opaque struct {
+	Id int64 `dml:"id"`
+}
+
+func (o *Opaque) NoDefaults() {}
+
+type Node struct {
+	*Node
+	X int `dml:"x"`
+}
+
+const userQuery = "SELECT id, name, created_by FROM users"
+
+func ok(db *DB) {
+	var u User
+	rows, _ := dml.X(db.Query(userQuery))
+	dml.Scan(rows, &u)
+	dml.Scan(rows, &u)
+
+	var us []User
+	rows, _ = dml.X(db.Query("SELECT u.id, upper(name) AS name, created_by::int8 FROM users u WHERE id = $1", 1))
+	dml.ScanArray(rows, &us)
+
+	dml.QuickScan(db.QueryRow("SELECT created_by, id, name FROM users"), &u)
+	dml.Scan(rows, &u, &u)
+
+	var l Login
+	rows, _ = dml.X(db.Query("SELECT user_name FROM users"))
+	dml.Scan(rows, &l)
+	dml.QuickScan(db.QueryRow("SELECT username FROM users"), &l)
+}
+
+func skipped(db *DB) {
+	var u User
+	var o Opaque
+	rows, _ := dml.X(db.Query("SELECT * FROM users"))
+	dml.Scan(rows, &u)
+	rows, _ = dml.X(db.Query("SELECT nope FROM users"))
+	dml.Scan(rows, &o)
+	dml.ScanWithMap(rows, nil, &u)
+
+	// types which embed themselves fail at runtime, and aren't examined.
+	var n Node
+	rows, _ = dml.X(db.Query("SELECT nope FROM nodes"))
+	dml.Scan(rows, &n)
+}
+
+func bad(db *DB) {
+	var u User
+	var c Custom
+	var us []*User
+	rows, _ := dml.X(db.Query("SELECT id, username, created_by FROM users"))
+	dml.Scan(rows, &u) // want `column "username" is selected but no field of User is tagged with it` `field User.Name is tagged "name", which is never selected`
+
+	rows, _ = dml.X(db.Query(`SELECT DISTINCT id, name FROM users`))
+	dml.ScanArray(rows, &us) // want `field User.Audit.CreatedBy is tagged "created_by", which is never selected`
+
+	dml.QuickScan(db.QueryRow("SELECT id, name FROM users"), &u) // want `query selects 2 columns, but User has 3 tagged fields`
+	dml.QuickScan(db.QueryRow("SELECT id, name, created_by FROM users"), &u) // want `column 1 is "id", but scans into field User.Audit.CreatedBy, which is tagged "created_by"` `column 2 is "name", but scans into field User.Id, which is tagged "id"` `column 3 is "created_by", but scans into field User.Name, which is tagged "name"`
+
+	rows, _ = dml.X(db.Query("SELECT extra FROM users"))
+	dml.Scan(rows, &c) // want `field Custom.Id is tagged "id", which is never selected`
+
+	var l Login
+	rows, _ = dml.X(db.Query("SELECT login FROM users"))
+	dml.Scan(rows, &l) // want `column "login" is selected but no field of Login is tagged with it` `field Login.Username is tagged "username|user_name", which is never selected`
+
+	var p Profile
+	rows, _ = dml.X(db.Query("SELECT bio, theme, language FROM profiles"))
+	dml.Scan(rows, &p) // want `field Profile.Id is required, but its column "id" is never selected`
+
+	rows, _ = dml.X(db.Query("SELECT id, language FROM profiles"))
+	dml.Scan(rows, &p) // want `field Profile.Bio is tagged "bio", which is never selected` `field Profile.Theme is tagged "theme", which is never selected`
+
+	func() {
+		rows, _ := dml.X(db.Query("SELECT id, name, created_by, count(*) n FROM users"))
+		dml.Scan(rows, &u) // want `column "n" is selected but no field of User is tagged with it`
+	}()
+}
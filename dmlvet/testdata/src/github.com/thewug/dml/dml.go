@@ -0,0 +1,21 @@
+// Package dml is a stub of the real package, with just enough of its API for the analyzer tests.
+package dml
+
+type Scannable interface{ Scan(...interface{}) error }
+
+type IterableScannable interface {
+	Scannable
+	ColumnNames() ([]string, error)
+	Next() bool
+}
+
+type NamedFields struct {
+	Names  []string
+	Fields []interface{}
+}
+
+func X(rows Scannable, err error) (IterableScannable, error)          { return nil, err }
+func Scan(s IterableScannable, into ...interface{}) error              { return nil }
+func ScanArray(s IterableScannable, into ...interface{}) error         { return nil }
+func QuickScan(s Scannable, into ...interface{}) error                 { return nil }
+func ScanWithMap(s Scannable, m []int, into ...interface{}) error      { return nil }
@@ -4,11 +4,13 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,6 +28,7 @@ var _ Scannable =         &sql.Row{}
 var _ Scannable =          dumbAssFuckinAdapter{sqlRows: (*sql.Rows)(nil)}
 var _ AdvancedScannable =  dumbAssFuckinAdapter{sqlRows: (*sql.Rows)(nil)}
 var _ IterableScannable =  dumbAssFuckinAdapter{sqlRows: (*sql.Rows)(nil)}
+var _ ColumnInfoScannable = dumbAssFuckinAdapter{sqlRows: (*sql.Rows)(nil)}
 var _ Scannable =         &scannableWrapper{}
 var _ AdvancedScannable = &scannableWrapper{}
 var _ IterableScannable = &scannableWrapper{}
@@ -124,8 +127,8 @@ func Test_buildNamedFieldsCacheForType(t *testing.T) {
 	v_type := v_raw.Type()
 	tagged_fields := 5
 
-	cache, err := buildFieldCacheEntryForType(v_type, nil)
-	if err != nil { t.Errorf("Unexpected return value (buildFieldCacheEntryForType()): got %v, expected nil", err) }
+	cache, err := DefaultMapper.buildFieldCacheEntryForType(v_type, nil)
+	if err != nil { t.Errorf("Unexpected return value (DefaultMapper.buildFieldCacheEntryForType()): got %v, expected nil", err) }
 	if len(cache.Names) != tagged_fields { t.Errorf("Unexpected state (cache.Names): wrong length, got %d, expected %d", len(cache.Names), tagged_fields) }
 	if len(cache.Fields) != tagged_fields { t.Errorf("Unexpected state (cache.Fields): wrong length, got %d, expected %d", len(cache.Fields), tagged_fields) }
 	if len(cache.IsScanner) != tagged_fields { t.Errorf("Unexpected state (cache.IsScanner): wrong length, got %d, expected %d", len(cache.IsScanner), tagged_fields) }
@@ -138,7 +141,7 @@ func Test_buildNamedFieldsCacheForType(t *testing.T) {
 		}
 	}
 
-	cache, err = buildFieldCacheEntryForType(reflect.TypeOf(int(1)), nil)
+	cache, err = DefaultMapper.buildFieldCacheEntryForType(reflect.TypeOf(int(1)), nil)
 	if err != nil || len(cache.Names) != 0 { t.Errorf("Unexpected state: got %v, %v; wanted %v, %v", err, cache, error(nil), fieldCacheEntry{}) }
 	
 	x0 := X0(x)
@@ -147,8 +150,8 @@ func Test_buildNamedFieldsCacheForType(t *testing.T) {
 	v_type = v_raw.Type()
 	tagged_fields = 0
 	
-	cache, err = buildFieldCacheEntryForType(v_type, nil)
-	if err != nil { t.Errorf("Unexpected return value (buildFieldCacheEntryForType()): got %v, expected nil", err) }
+	cache, err = DefaultMapper.buildFieldCacheEntryForType(v_type, nil)
+	if err != nil { t.Errorf("Unexpected return value (DefaultMapper.buildFieldCacheEntryForType()): got %v, expected nil", err) }
 	if len(cache.Names) != tagged_fields { t.Errorf("Unexpected state (cache.Names): wrong length, got %d, expected %d", len(cache.Names), tagged_fields) }
 	if len(cache.Fields) != tagged_fields { t.Errorf("Unexpected state (cache.Fields): wrong length, got %d, expected %d", len(cache.Fields), tagged_fields) }
 	if len(cache.IsScanner) != tagged_fields { t.Errorf("Unexpected state (cache.IsScanner): wrong length, got %d, expected %d", len(cache.IsScanner), tagged_fields) }
@@ -167,14 +170,14 @@ func Test_GetFieldsFrom(t *testing.T) {
 	y := Y{E1: E1{Test: "value3"}, E2: E2{Test: "value4"}, Test1: "value1", Test2: "value2"}
 	y_type := reflect.TypeOf(y)
 
-	if cached, ok := fieldsCache[y_type]; ok { t.Errorf("1: Expected no cached value, but got one: %+v", cached) }
+	if cached, ok := DefaultMapper.cache.Load(y_type); ok { t.Errorf("1: Expected no cached value, but got one: %+v", cached) }
 	_, err := GetFieldsFrom(y)
 	if err == nil || !strings.Contains(err.Error(), "incompatible object type") { t.Errorf("2: Unexpected return value (buildNamedFieldsCacheForType()): got %v, expected 'not addressable' error", err) }
-	if cached, ok := fieldsCache[y_type]; ok { t.Errorf("3: Expected no cached value, but got one: %+v", cached) }
+	if cached, ok := DefaultMapper.cache.Load(y_type); ok { t.Errorf("3: Expected no cached value, but got one: %+v", cached) }
 
 	fields, err := GetFieldsFrom(&y)
 	if err != nil { t.Errorf("4: Unexpected return value (GetFieldsFrom): got %v, expected nil", err) }
-	if _, ok := fieldsCache[y_type]; !ok { t.Errorf("5: Expected cached value, but got empty value instead!") }
+	if _, ok := DefaultMapper.cache.Load(y_type); !ok { t.Errorf("5: Expected cached value, but got empty value instead!") }
 	fields_again, err := GetFieldsFrom(&y)
 	if err != nil { t.Errorf("6: Unexpected return value (GetFieldsFrom): got %v, expected nil", err) }
 
@@ -426,9 +429,70 @@ func Test_dumbAssFuckinAdapter(t *testing.T) {
 	names, err := rows.ColumnNames()
 	if !reflect.DeepEqual(row_titles, names) { t.Errorf("Unexpected return values (ColumnNames): got %v, expected %v", names, row_titles) }
 	if err != nil { t.Errorf("Unexpected return values (ColumnNames): got %v, expected nil", err) }
+	columns, err := rows.(ColumnInfoScannable).Columns()
+	if err != nil || len(columns) != 3 || columns[1].Name != "field_2" { t.Errorf("Unexpected return values (Columns): got %+v, %v; expected three columns", columns, err) }
 	rows.(dumbAssFuckinAdapter).sqlRows.(*sql.Rows).Close()
 	names, err = rows.ColumnNames()
 	if err == nil { t.Errorf("Unexpected return values (ColumnNames): got nil, expected anything else") }
+	if _, err = rows.(ColumnInfoScannable).Columns(); err == nil { t.Errorf("Unexpected return values (Columns): got nil, expected anything else") }
+}
+
+type X23 struct {
+	Id   int64  `dml:"id"`
+	Name string `dml:"name"`
+}
+
+type X24 struct {
+	Id    int64  `dml:"id"`
+	Title string `dml:"title"`
+}
+
+func Test_MultipleResultSets(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT id, name FROM users; SELECT title, id FROM posts"
+	expect := func() {
+		mock.ExpectQuery("SELECT").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name"}).AddRow(int64(1), "alice"),
+			sqlmock.NewRows([]string{"title", "id"}).AddRow("hello", int64(7)).AddRow("again", int64(8)),
+		)
+	}
+	expected := []X24{{7, "hello"}, {8, "again"}}
+
+	// moving the *sql.Rows to the next result set directly, and through the adapter.
+	for _, through := range []string{"sql.Rows", "adapter"} {
+		expect()
+		raw, err := db.Query(query)
+		if err != nil { t.Fatalf("Unexpected return value (Query): got %v, expected nil", err) }
+		rows, _ := X(raw, nil)
+
+		var users []X23
+		if err := ScanArray(rows, &users); err != nil || len(users) != 1 || users[0].Name != "alice" { t.Errorf("Unexpected result (ScanArray, %s): got %+v, %v", through, users, err) }
+
+		next := raw.NextResultSet
+		if through == "adapter" { next = rows.(interface{ NextResultSet() bool }).NextResultSet }
+		if !next() { t.Fatalf("Expected a second result set (%s)", through) }
+
+		var posts []X24
+		if err := ScanArray(rows, &posts); err != nil || !reflect.DeepEqual(posts, expected) { t.Errorf("Unexpected result (ScanArray, %s): got %+v, %v, expected %+v", through, posts, err, expected) }
+		rows.Close()
+	}
+}
+
+func Test_NoColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	// unlike a varying source's empty row, a result set without columns is a mistake.
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{}).AddRow())
+	rows, _ := X(db.Query("SELECT"))
+	defer rows.Close()
+	rows.Next()
+	var x X23
+	if err := Scan(rows, &x); err == nil || err.Error() != "cannot scan into empty list of fields" { t.Errorf("Unexpected return value (Scan): got %v, expected empty list error", err) }
 }
 
 func p(array []ScanInto) string {
@@ -751,3 +815,1136 @@ func Test_ScanArray(t *testing.T) {
 		})
 	}
 }
+
+func Test_checkColumn(t *testing.T) {
+	var i int64
+	var pi *int64
+	var s string
+	var ps *string
+	var b []byte
+	var ns sql.NullString
+	var f float64
+	var tm time.Time
+	var any interface{}
+
+	testcases := map[string]struct{
+		column ColumnInfo
+		field interface{}
+		err string
+	}{
+		"int-int":          {ColumnInfo{ScanType: reflect.TypeOf(int64(0))}, &i, ""},
+		"int-string":       {ColumnInfo{ScanType: reflect.TypeOf(int64(0))}, &s, ""},
+		"float-int":        {ColumnInfo{ScanType: reflect.TypeOf(float64(0))}, &i, "cannot convert"},
+		"text-int":         {ColumnInfo{ScanType: reflect.TypeOf(""), DatabaseTypeName: "TEXT"}, &i, "cannot convert TEXT"},
+		"bytes-int":        {ColumnInfo{ScanType: reflect.TypeOf([]byte(nil)), DatabaseTypeName: "NUMERIC"}, &i, ""},
+		"bytes-text-int":   {ColumnInfo{ScanType: reflect.TypeOf([]byte(nil)), DatabaseTypeName: "varchar"}, &i, "cannot convert"},
+		"time-time":        {ColumnInfo{ScanType: reflect.TypeOf(time.Time{})}, &tm, ""},
+		"time-float":       {ColumnInfo{ScanType: reflect.TypeOf(time.Time{})}, &f, "cannot convert"},
+		"nullable-int":     {ColumnInfo{ScanType: reflect.TypeOf(int64(0)), Nullable: true, NullableKnown: true}, &i, "nullable"},
+		"nullable-ptr":     {ColumnInfo{ScanType: reflect.TypeOf(int64(0)), Nullable: true, NullableKnown: true}, &pi, ""},
+		"nullable-bytes":   {ColumnInfo{ScanType: reflect.TypeOf(""), Nullable: true, NullableKnown: true}, &b, ""},
+		"nullable-scanner": {ColumnInfo{ScanType: reflect.TypeOf(""), Nullable: true, NullableKnown: true}, &ns, ""},
+		"nullable-unknown": {ColumnInfo{ScanType: reflect.TypeOf(""), Nullable: true}, &s, ""},
+		"null-type":        {ColumnInfo{ScanType: reflect.TypeOf(sql.NullString{})}, &s, "nullable"},
+		"null-type-ptr":    {ColumnInfo{ScanType: reflect.TypeOf(sql.NullString{})}, &ps, ""},
+		"null-type-wrong":  {ColumnInfo{ScanType: reflect.TypeOf(sql.NullString{})}, &pi, "cannot convert"},
+		"interface":        {ColumnInfo{ScanType: reflect.TypeOf(""), Nullable: true, NullableKnown: true}, &any, ""},
+		"noop":             {ColumnInfo{ScanType: reflect.TypeOf("")}, noopScanner{}, ""},
+		"no-scan-type":     {ColumnInfo{}, &i, ""},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			reason := checkColumn(v.column, v.field)
+			if v.err == "" && reason != "" { t.Errorf("Unexpected return value (checkColumn): got %q, expected nothing", reason) }
+			if v.err != "" && !strings.Contains(reason, v.err) { t.Errorf("Unexpected return value (checkColumn): got %q, expected '%s'", reason, v.err) }
+		})
+	}
+}
+
+type X5 struct {
+	Id    int64  `dml:"id"`
+	Name  string `dml:"name"`
+	Score int64  `dml:"score"`
+}
+
+func Test_ValidateMap(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT id, name, score FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRowsWithColumnDefinition(
+			mock.NewColumn("id").OfType("INT8", int64(0)).Nullable(false),
+			mock.NewColumn("name").OfType("TEXT", "").Nullable(true),
+			mock.NewColumn("score").OfType("TEXT", "").Nullable(false),
+		).AddRow(int64(1), nil, "high"),
+	)
+
+	var x X5
+	rows, _ := X(db.Query(query))
+	defer rows.Close()
+	fields, _ := GetFieldsFrom(&x)
+	m, _ := BuildMap(rows, fields)
+
+	err = ValidateMap(rows, m, fields)
+	mismatches, ok := err.(TypeMismatchError)
+	if !ok { t.Fatalf("Unexpected return value (ValidateMap): got %v, expected a TypeMismatchError", err) }
+	if len(mismatches) != 2 || mismatches[0].Name != "name" || mismatches[1].Name != "score" { t.Errorf("Unexpected return value (ValidateMap): got %+v, expected mismatches for name and score", mismatches) }
+
+	if err = ValidateMap(&RowMock{columns: []string{"id"}}, ScanMap{0}, fields); err != nil { t.Errorf("Unexpected return value (ValidateMap): got %v, expected nil for a scannable without types", err) }
+
+	// fields with defaults are reported with their own type, rather than that of their wrapper.
+	var n int64
+	err = validateColumns([]ColumnInfo{{Name: "n", ScanType: timeType}}, nil, nil, NamedFields{Names: []string{"n"}, Fields: []interface{}{Default(&n, 3)}})
+	if mismatches, ok := err.(TypeMismatchError); !ok || len(mismatches) != 1 || mismatches[0].Field != reflect.TypeOf(n) { t.Errorf("Unexpected return value (validateColumns): got %v, expected a mismatch for an int64 field", err) }
+
+	// so are fields behind nil embedded pointers, which are left nil.
+	var x21 X21
+	embedded, err := GetFieldsFrom(&x21)
+	if err != nil { t.Fatalf("Unexpected return value (GetFieldsFrom): got %v, expected nil", err) }
+	err = validateColumns([]ColumnInfo{{Name: "created", ScanType: reflect.TypeOf(true)}}, ScanMap{0}, nil, embedded)
+	if mismatches, ok := err.(TypeMismatchError); !ok || len(mismatches) != 1 || mismatches[0].Field != timeType || x21.Stamped != nil { t.Errorf("Unexpected return value (validateColumns): got %v, expected a mismatch for a time.Time field", err) }
+
+	DefaultMapper.ValidateTypes = true
+	defer func() { DefaultMapper.ValidateTypes = false }()
+	var xs []X5
+	err = ScanArray(rows, &xs)
+	if _, ok := err.(TypeMismatchError); !ok || len(xs) != 0 { t.Errorf("Unexpected return value (ScanArray): got %v and %d rows, expected a TypeMismatchError and no rows", err, len(xs)) }
+}
+
+func Test_ColumnsOf(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT name, price FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRowsWithColumnDefinition(
+			mock.NewColumn("name").OfType("VARCHAR", "").WithLength(64).Nullable(true),
+			mock.NewColumn("price").OfType("DECIMAL", float64(0)).WithPrecisionAndScale(10, 2),
+		),
+	)
+	rows, _ := X(db.Query(query))
+	defer rows.Close()
+
+	testcases := map[string]struct{
+		adv AdvancedScannable
+		columns []ColumnInfo
+	}{
+		"names-only": {&RowMock{columns: []string{"a", "b"}}, []ColumnInfo{{Name: "a"}, {Name: "b"}}},
+		"nothing":    {WrapBasic(&FakeRow{}), nil},
+		"sql": {rows, []ColumnInfo{
+			{Name: "name", DatabaseTypeName: "VARCHAR", ScanType: reflect.TypeOf(""), Nullable: true, NullableKnown: true, Length: 64, HasLength: true},
+			{Name: "price", DatabaseTypeName: "DECIMAL", ScanType: reflect.TypeOf(float64(0)), Precision: 10, Scale: 2, HasPrecisionScale: true},
+		}},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			columns, err := ColumnsOf(v.adv)
+			if err != nil { t.Errorf("Unexpected return value (ColumnsOf): got %v, expected nil", err) }
+			if !reflect.DeepEqual(columns, v.columns) { t.Errorf("Unexpected return value (ColumnsOf): got %+v, expected %+v", columns, v.columns) }
+		})
+	}
+}
+
+func Test_ParseTag(t *testing.T) {
+	testcases := map[string]struct{
+		tag reflect.StructTag
+		out FieldTag
+		ok bool
+		err string
+	}{
+		"none":    {`json:"x"`, FieldTag{}, false, ""},
+		"name":    {`dml:"x"`, FieldTag{Name: "x"}, true, ""},
+		"default": {`dml:"x,default=3"`, FieldTag{Name: "x", Default: "3", HasDefault: true}, true, ""},
+		"empty":   {`dml:"x,default="`, FieldTag{Name: "x", HasDefault: true}, true, ""},
+		"required":{`dml:"x,required"`, FieldTag{Name: "x", Required: true}, true, ""},
+		"req+def": {`dml:"x,required,default=1"`, FieldTag{}, true, "options required and default can't be combined"},
+		"json":    {`dml:"x,json"`, FieldTag{Name: "x", JSON: true}, true, ""},
+		"json+def":{`dml:"x,json,default=1"`, FieldTag{}, true, "can't be combined"},
+		"array":   {`dml:"x,array"`, FieldTag{Name: "x", Array: true}, true, ""},
+		"arr+json":{`dml:"x,array,json"`, FieldTag{}, true, "can't be combined"},
+		"hstore":  {`dml:"x,hstore"`, FieldTag{Name: "x", Hstore: true}, true, ""},
+		"comp":    {`dml:"x,composite"`, FieldTag{Name: "x", Composite: true}, true, ""},
+		"attrs":   {`dml:"x,composite=a;b"`, FieldTag{Name: "x", Composite: true, Attributes: "a;b"}, true, ""},
+		"comp+def":{`dml:"x,composite,default=1"`, FieldTag{}, true, "options default and composite can't be combined"},
+		"unknown": {`dml:"x,bogus"`, FieldTag{}, true, "unknown dml tag option"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			out, ok, err := ParseTag(v.tag)
+			if v.err == "" && err != nil { t.Errorf("Unexpected return value (ParseTag): got %v, expected nil", err) }
+			if v.err != "" && (err == nil || !strings.Contains(err.Error(), v.err)) { t.Errorf("Unexpected return value (ParseTag): got %v, expected '%s' error", err, v.err) }
+			if ok != v.ok || out != v.out { t.Errorf("Unexpected return value (ParseTag): got %+v, %v; expected %+v, %v", out, ok, v.out, v.ok) }
+		})
+	}
+}
+
+func Test_parseDefault(t *testing.T) {
+	type level int16
+	testcases := map[string]struct{
+		t reflect.Type
+		in string
+		out interface{}
+		err string
+	}{
+		"int":      {reflect.TypeOf(int(0)), "3", int(3), ""},
+		"hex":      {reflect.TypeOf(uint8(0)), "0x10", uint8(16), ""},
+		"named":    {reflect.TypeOf(level(0)), "-2", level(-2), ""},
+		"pointer":  {reflect.TypeOf((*float64)(nil)), "1.5", float64(1.5), ""},
+		"bool":     {reflect.TypeOf(false), "true", true, ""},
+		"string":   {reflect.TypeOf(""), "hello", "hello", ""},
+		"overflow": {reflect.TypeOf(int8(0)), "300", nil, "bad default value"},
+		"struct":   {reflect.TypeOf(time.Time{}), "now", nil, "not supported"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			out, err := ParseDefault(v.t, v.in)
+			if v.err == "" && err != nil { t.Errorf("Unexpected return value (ParseDefault): got %v, expected nil", err) }
+			if v.err != "" && (err == nil || !strings.Contains(err.Error(), v.err)) { t.Errorf("Unexpected return value (ParseDefault): got %v, expected '%s' error", err, v.err) }
+			if out != v.out { t.Errorf("Unexpected return value (ParseDefault): got %#v, expected %#v", out, v.out) }
+		})
+	}
+}
+
+type X6 struct {
+	Id      int64   `dml:"id"`
+	Retries int     `dml:"retries,default=3"`
+	Name    string  `dml:"name,default=nobody"`
+	Limit   *uint16 `dml:"limit,default=10"`
+}
+
+type X7 struct {
+	Id int64 `dml:"id,default=nope"`
+}
+
+// X7b's unexported fields are ignored, tags and all.
+type X7b struct {
+	Id      int64  `dml:"id"`
+	retries int    `dml:"retries,default=nope"`
+	name    string `dml:"name,bogus"`
+}
+
+func Test_Defaults(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT id, retries, name FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "retries", "name"}).
+		AddRow(int64(1), nil, "alice").
+		AddRow(int64(2), int64(5), nil),
+	)
+
+	var xs []X6
+	rows, _ := X(db.Query(query))
+	if err := ScanArray(rows, &xs); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	rows.Close()
+
+	ten := uint16(10)
+	expected := []X6{{1, 3, "alice", &ten}, {2, 5, "nobody", &ten}}
+	if !reflect.DeepEqual(xs, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", xs, expected) }
+	if xs[0].Limit == xs[1].Limit { t.Errorf("Unexpected result (ScanArray): default pointers should not be shared") }
+
+	// an existing value is replaced by the default if the column is missing.
+	x := X6{Retries: 7}
+	err = Scan(&RowMock{columns: []string{"name"}, values: []string{"bob"}}, &x)
+	if err != nil || x.Retries != 3 || x.Name != "bob" { t.Errorf("Unexpected result (Scan): got %+v, %v; expected defaults for missing columns", x, err) }
+
+	// defaults which can't be stored are errors, rather than panics.
+	var n int
+	if err := Default(&n, nil).Scan(nil); err == nil || err.Error() != "default value for int is nil" { t.Errorf("Unexpected return value (Scan): got %v, expected a nil default error", err) }
+	if err := Default(nil, 3).Scan(nil); err == nil || err.Error() != "cannot store a default value in <nil>" { t.Errorf("Unexpected return value (Scan): got %v, expected a nil field error", err) }
+	if err := Default(n, 3).Scan(nil); err == nil || err.Error() != "cannot store a default value in int" { t.Errorf("Unexpected return value (Scan): got %v, expected a non-pointer error", err) }
+
+	if _, err := DefaultMapper.buildFieldCacheEntryForType(reflect.TypeOf(X7{}), nil); err == nil || !strings.Contains(err.Error(), "bad default value") { t.Errorf("Unexpected return value (buildFieldCacheEntryForType): got %v, expected 'bad default value' error", err) }
+	if entry, err := DefaultMapper.buildFieldCacheEntryForType(reflect.TypeOf(X7b{}), nil); err != nil || !reflect.DeepEqual(entry.Names, []string{"id"}) { t.Errorf("Unexpected return value (buildFieldCacheEntryForType): got %v, %v, expected only id", entry.Names, err) }
+}
+
+type X8 struct {
+	Id   string `dml:"id,required"`
+	Name string `dml:"name,required"`
+	Note string `dml:"note"`
+}
+
+func Test_Required(t *testing.T) {
+	var x X8
+	err := Scan(&RowMock{columns: []string{"id", "name"}, values: []string{"1", "bob"}}, &x)
+	if err != nil || x.Id != "1" || x.Name != "bob" { t.Errorf("Unexpected result (Scan): got %+v, %v; expected optional column to be skippable", x, err) }
+
+	err = Scan(&RowMock{columns: []string{"note"}, values: []string{"hi"}}, &x)
+	if err == nil || !strings.Contains(err.Error(), `dml.X8 requires column "id", dml.X8 requires column "name"`) { t.Errorf("Unexpected return value (Scan): got %v, expected error naming both missing columns", err) }
+
+	// required indexes follow their fields when NamedFields are appended.
+	fields, err := BuildNamedFields([]ScanInto{&X1{}, &X8{}})
+	if err != nil { t.Fatalf("Unexpected return value (BuildNamedFields): got %v, expected nil", err) }
+	expected := []RequiredField{{len(fields.Names) - 3, "dml.X8"}, {len(fields.Names) - 2, "dml.X8"}}
+	if !reflect.DeepEqual(fields.Required, expected) { t.Errorf("Unexpected result (BuildNamedFields): got %+v, expected %+v", fields.Required, expected) }
+
+	// both lookup strategies in BuildMap check required fields.
+	wide := make([]string, 20)
+	for i := range wide { wide[i] = fmt.Sprintf("c%d", i) }
+	for _, columns := range [][]string{{"id"}, append(wide, "id")} {
+		var nf NamedFields
+		nf.PushRequired("id", new(int), "T")
+		nf.PushRequired("name", new(string), "T")
+		for _, c := range wide { nf.Push(c, new(int)) }
+		_, err := BuildMap(&RowMock{columns: columns}, nf)
+		if err == nil || err.Error() != `required columns missing from result set: T requires column "name"` { t.Errorf("Unexpected return value (BuildMap, %d columns): got %v, expected missing name", len(columns), err) }
+	}
+}
+
+type color int
+
+type X9 struct {
+	Created time.Time     `dml:"created"`
+	Color   color         `dml:"color"`
+	Timeout time.Duration `dml:"timeout"`
+	Delay   time.Duration `dml:"delay"`
+	Name    string        `dml:"name"`
+}
+
+func Test_Converters(t *testing.T) {
+	defer func(c *Converters) { DefaultConverters, DefaultMapper.Converters = c, c }(DefaultConverters)
+	DefaultConverters = NewConverters()
+	DefaultMapper.Converters = DefaultConverters
+
+	RegisterConverter(func(s int64) (time.Time, error) { return time.Unix(s, 0).UTC(), nil })
+	RegisterConverter(func(f float64) (time.Duration, error) { return time.Duration(f * float64(time.Second)), nil })
+	RegisterConverter(func(i int64) (time.Duration, error) { return time.Duration(i) * time.Millisecond, nil })
+	RegisterConverter(func(s string) (color, error) { return 0, errors.New("placeholder") })
+	RegisterConverter(func(s string) (color, error) {
+		switch s {
+		case "red": return 1, nil
+		case "blue": return 2, nil
+		}
+		return 0, fmt.Errorf("unknown color %q", s)
+	})
+	for _, fn := range []interface{}{nil, 5, func(s string) color { return 0 }, func(s ...string) (color, error) { return 0, nil }, func(s string) (color, bool) { return 0, false }} {
+		if err := RegisterConverter(fn); err == nil || !strings.HasPrefix(err.Error(), "converter must be a func(T) (U, error)") { t.Errorf("Unexpected return value (RegisterConverter, %T): got %v, expected an error", fn, err) }
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT created, color, timeout, delay, name FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRowsWithColumnDefinition(
+			mock.NewColumn("created").OfType("BIGINT", int64(0)),
+			mock.NewColumn("color").OfType("TEXT", ""),
+			mock.NewColumn("timeout").OfType("REAL", float64(0)),
+			mock.NewColumn("delay").OfType("BIGINT", int64(0)),
+			mock.NewColumn("name").OfType("TEXT", ""),
+		).
+		AddRow(int64(86400), "red", float64(1.5), int64(250), "a").
+		AddRow(int64(0), []byte("blue"), "2", "3", "b"),
+	)
+
+	var xs []X9
+	rows, _ := X(db.Query(query))
+	if err := ScanArray(rows, &xs); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	rows.Close()
+
+	expected := []X9{
+		{time.Unix(86400, 0).UTC(), 1, 1500 * time.Millisecond, 250 * time.Millisecond, "a"},
+		{time.Unix(0, 0).UTC(), 2, 2 * time.Second, 3 * time.Millisecond, "b"},
+	}
+	if !reflect.DeepEqual(xs, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", xs, expected) }
+
+	// drivers which don't report scan types have them reported as interface{}, which is unknown.
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"created", "color", "name"}).AddRow(int64(86400), "red", "a"))
+	xs = nil
+	rows, _ = X(db.Query(query))
+	if columns, err := rows.(ColumnInfoScannable).Columns(); err != nil || columns[0].ScanType != nil { t.Errorf("Unexpected return value (Columns): got %+v, %v; expected unknown scan types", columns, err) }
+	if err := ScanArray(rows, &xs); err != nil || len(xs) != 1 || !xs[0].Created.Equal(time.Unix(86400, 0)) || xs[0].Color != 1 { t.Errorf("Unexpected result (ScanArray): got %+v, %v", xs, err) }
+	rows.Close()
+
+	// without column types, the converter is chosen by the type of each value.
+	var x X9
+	err = Scan(&RowMock{columns: []string{"color"}, values: []string{"blue"}}, &x)
+	if err != nil || x.Color != 2 { t.Errorf("Unexpected result (Scan): got %v, %v; expected 2, nil", x.Color, err) }
+	c := DefaultConverters.choose(ColumnInfo{}, &x.Color)
+	if err := c.assign(&x.Color, "green"); err == nil || !strings.Contains(err.Error(), `unknown color "green"`) { t.Errorf("Unexpected return value (assign): got %v, expected converter error", err) }
+
+	d := DefaultConverters.choose(ColumnInfo{}, &x.Delay)
+	if d == nil || d.assign(&x.Delay, int64(4)) != nil || x.Delay != 4 * time.Millisecond { t.Errorf("Unexpected result (choose): got %v, expected int64 converter", x.Delay) }
+	if err := d.assign(&x.Delay, float64(4)); err != nil || x.Delay != 4 * time.Second { t.Errorf("Unexpected result (choose): got %v, %v; expected float64 converter", x.Delay, err) }
+	if c := DefaultConverters.choose(ColumnInfo{ScanType: reflect.TypeOf(true)}, &x.Delay); c != nil { t.Errorf("Unexpected result (choose): got a converter for a bool column, expected none") }
+	if c := DefaultConverters.choose(ColumnInfo{}, &x.Name); c != nil { t.Errorf("Unexpected result (choose): got a converter for a string field, expected none") }
+
+	// DefaultMapper uses whichever converters it is given.
+	DefaultMapper.Converters = NewConverters()
+	x.Color = 0
+	err = Scan(&RowMock{columns: []string{"color"}, values: []string{"blue"}}, &x)
+	if err == nil || x.Color != 0 { t.Errorf("Unexpected result (Scan): got %v, %v; expected the color not to be converted", x.Color, err) }
+}
+
+type cents int64
+
+type Stamped struct {
+	Created time.Time `dml:"created"`
+}
+
+type X21 struct {
+	*Stamped
+	Id    int64 `dml:"id"`
+	Price cents `dml:"price,default=5"`
+}
+
+func Test_ConverterWrappers(t *testing.T) {
+	m := NewMapper()
+	AddConverter(m.Converters, func(s int64) (time.Time, error) { return time.Unix(s, 0).UTC(), nil })
+	AddConverter(m.Converters, func(s string) (cents, error) {
+		if s == "abc" { return 123, nil }
+		return 0, fmt.Errorf("bad price %q", s)
+	})
+
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	// created is behind a nil embedded pointer, and price has a default, so neither is scanned into directly.
+	query := "SELECT id, created, price FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRowsWithColumnDefinition(
+			mock.NewColumn("id").OfType("BIGINT", int64(0)),
+			mock.NewColumn("created").OfType("BIGINT", int64(0)),
+			mock.NewColumn("price").OfType("TEXT", ""),
+		).
+		AddRow(int64(1), int64(86400), "abc").
+		AddRow(int64(2), int64(0), nil),
+	)
+
+	var xs []X21
+	rows, _ := X(db.Query(query))
+	if err := m.ScanArray(rows, &xs); err != nil { t.Fatalf("Unexpected return value (Mapper.ScanArray): got %v, expected nil", err) }
+	rows.Close()
+
+	expected := []X21{
+		{&Stamped{time.Unix(86400, 0).UTC()}, 1, 123},
+		{&Stamped{time.Unix(0, 0).UTC()}, 2, 5},
+	}
+	if !reflect.DeepEqual(xs, expected) { t.Errorf("Unexpected result (Mapper.ScanArray): got %+v, expected %+v", xs, expected) }
+
+	var x X21
+	fields, err := m.GetFieldsFrom(&x)
+	if err != nil { t.Fatalf("Unexpected return value (Mapper.GetFieldsFrom): got %v, expected nil", err) }
+	if c := m.Converters.choose(ColumnInfo{}, fields.Fields[0]); c == nil || c.dst != reflect.TypeOf(time.Time{}) { t.Errorf("Unexpected result (choose): got %v, expected a converter to time.Time through the nil embedded pointer", c) }
+	if c := m.Converters.choose(ColumnInfo{}, fields.Fields[2]); c == nil || c.dst != reflect.TypeOf(cents(0)) { t.Errorf("Unexpected result (choose): got %v, expected a converter to cents through the default", c) }
+	if x.Stamped != nil { t.Errorf("Expected choosing converters not to allocate the embedded pointer") }
+}
+
+type settings struct {
+	Theme string `json:"theme"`
+	Size  int    `json:"size"`
+}
+
+type X10 struct {
+	Id       int64             `dml:"id"`
+	Settings settings          `dml:"settings,json"`
+	Tags     []string          `dml:"tags,json"`
+	Meta     map[string]string `dml:"meta,json"`
+}
+
+func Test_JSON(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT id, settings, tags, meta FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "settings", "tags", "meta"}).
+		AddRow(int64(1), []byte(`{"theme":"dark","size":3}`), `["a","b"]`, nil).
+		AddRow(int64(2), nil, nil, []byte(`{"k":"v"}`)),
+	)
+
+	var xs []X10
+	rows, _ := X(db.Query(query))
+	if err := ScanArray(rows, &xs); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	rows.Close()
+
+	expected := []X10{
+		{1, settings{"dark", 3}, []string{"a", "b"}, nil},
+		{2, settings{}, nil, map[string]string{"k": "v"}},
+	}
+	if !reflect.DeepEqual(xs, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", xs, expected) }
+
+	// decoding replaces the old value entirely, rather than merging into it.
+	x := X10{Settings: settings{"light", 1}}
+	if err := JSON(&x.Settings).Scan(`{"size":2}`); err != nil || x.Settings != (settings{"", 2}) { t.Errorf("Unexpected result (Scan): got %+v, %v; expected {\"\" 2}", x.Settings, err) }
+	if err := JSON(&x.Settings).Scan(`{`); err == nil || !strings.Contains(err.Error(), "decoding JSON into dml.settings") { t.Errorf("Unexpected return value (Scan): got %v, expected decoding error", err) }
+	if err := JSON(&x.Settings).Scan(int64(3)); err == nil { t.Errorf("Unexpected return value (Scan): got nil, expected error for int64") }
+
+	v, err := JSON(&x.Settings).Value()
+	if err != nil || string(v.([]byte)) != `{"theme":"","size":2}` { t.Errorf("Unexpected return value (Value): got %s, %v", v, err) }
+	if v, err = JSON(&x.Tags).Value(); v != nil || err != nil { t.Errorf("Unexpected return value (Value): got %v, %v; expected NULL for nil slice", v, err) }
+
+	// the codec can be replaced.
+	defer func(m func(interface{}) ([]byte, error), u func([]byte, interface{}) error) { JSONMarshal, JSONUnmarshal = m, u }(JSONMarshal, JSONUnmarshal)
+	JSONMarshal = func(interface{}) ([]byte, error) { return []byte("custom"), nil }
+	JSONUnmarshal = func([]byte, interface{}) error { return constError1 }
+	if v, _ = JSON(&x.Settings).Value(); string(v.([]byte)) != "custom" { t.Errorf("Unexpected return value (Value): got %s, expected custom", v) }
+	if err := JSON(&x.Settings).Scan("{}"); !errors.Is(err, constError1) { t.Errorf("Unexpected return value (Scan): got %v, expected %v", err, constError1) }
+}
+
+func Test_parseArray(t *testing.T) {
+	testcases := map[string]struct{
+		in string
+		out []arrayElem
+		err string
+	}{
+		"empty":   {`{}`, []arrayElem{}, ""},
+		"simple":  {`{1,2,3}`, []arrayElem{{value: "1"}, {value: "2"}, {value: "3"}}, ""},
+		"null":    {`{a,NULL,null,"NULL"}`, []arrayElem{{value: "a"}, {value: "NULL", null: true}, {value: "null", null: true}, {value: "NULL"}}, ""},
+		"quoted":  {`{"a b","c\"d","e\\f",""}`, []arrayElem{{value: "a b"}, {value: `c"d`}, {value: `e\f`}, {value: ""}}, ""},
+		"spaces":  {` { a , b } `, []arrayElem{{value: "a"}, {value: "b"}}, ""},
+		"nested":  {`{{1,2},{3}}`, []arrayElem{{array: true, nested: []arrayElem{{value: "1"}, {value: "2"}}}, {array: true, nested: []arrayElem{{value: "3"}}}}, ""},
+		"dims":    {`[0:1]={5,6}`, []arrayElem{{value: "5"}, {value: "6"}}, ""},
+		"open":    {`{1,2`, nil, "unterminated array"},
+		"quote":   {`{"abc}`, nil, "unterminated quoted string"},
+		"trailing":{`{1}x`, nil, "unexpected trailing characters"},
+		"blank":   {`{1,,2}`, nil, "empty unquoted element"},
+		"brace":   {`1,2`, nil, "expected '{'"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			out, err := parseArray(v.in)
+			if v.err == "" && err != nil { t.Errorf("Unexpected return value (parseArray): got %v, expected nil", err) }
+			if v.err != "" && (err == nil || !strings.Contains(err.Error(), v.err)) { t.Errorf("Unexpected return value (parseArray): got %v, expected '%s' error", err, v.err) }
+			if !reflect.DeepEqual(out, v.out) { t.Errorf("Unexpected result (parseArray): got %+v, expected %+v", out, v.out) }
+		})
+	}
+}
+
+func Test_Array(t *testing.T) {
+	var ints []int64
+	if err := Array(&ints).Scan([]byte(`{1,2,3}`)); err != nil || !reflect.DeepEqual(ints, []int64{1, 2, 3}) { t.Errorf("Unexpected result (Scan): got %v, %v", ints, err) }
+	if err := Array(&ints).Scan(`{1,NULL}`); err == nil || !strings.Contains(err.Error(), "array element 1: NULL cannot be stored in int64") { t.Errorf("Unexpected return value (Scan): got %v, expected NULL error", err) }
+	if err := Array(&ints).Scan(nil); err != nil || ints != nil { t.Errorf("Unexpected result (Scan): got %v, %v; expected nil slice", ints, err) }
+
+	var ptrs []*string
+	if err := Array(&ptrs).Scan(`{a,NULL}`); err != nil || len(ptrs) != 2 || *ptrs[0] != "a" || ptrs[1] != nil { t.Errorf("Unexpected result (Scan): got %v, %v", ptrs, err) }
+
+	var nulls []sql.NullInt64
+	if err := Array(&nulls).Scan(`{NULL,4}`); err != nil || !reflect.DeepEqual(nulls, []sql.NullInt64{{}, {Int64: 4, Valid: true}}) { t.Errorf("Unexpected result (Scan): got %v, %v", nulls, err) }
+
+	var grid [][]int
+	if err := Array(&grid).Scan(`{{1,2},{3,4}}`); err != nil || !reflect.DeepEqual(grid, [][]int{{1, 2}, {3, 4}}) { t.Errorf("Unexpected result (Scan): got %v, %v", grid, err) }
+	if err := Array(&ints).Scan(`{{1}}`); err == nil || !strings.Contains(err.Error(), "cannot store a nested array") { t.Errorf("Unexpected return value (Scan): got %v, expected nested array error", err) }
+
+	one := "x"
+	testcases := map[string]struct{
+		field interface{}
+		out driver.Value
+	}{
+		"nil":     {new([]string), nil},
+		"empty":   {&[]string{}, "{}"},
+		"strings": {&[]string{"a", "b c", `d"e`, `f\g`, "", "NULL", "{}"}, `{a,"b c","d\"e","f\\g","","NULL","{}"}`},
+		"ints":    {&[]int64{1, -2}, "{1,-2}"},
+		"nulls":   {&[]*string{&one, nil}, "{x,NULL}"},
+		"valuers": {&[]sql.NullInt64{{Int64: 3, Valid: true}, {}}, "{3,NULL}"},
+		"nested":  {&[][]int{{1, 2}, {3, 4}}, "{{1,2},{3,4}}"},
+		"bools":   {&[]bool{true, false}, "{true,false}"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			out, err := Array(v.field).Value()
+			if err != nil || out != v.out { t.Errorf("Unexpected return value (Value): got %v, %v; expected %v, nil", out, err, v.out) }
+			if out == nil { return }
+
+			// whatever is written can be read back.
+			back := reflect.New(reflect.TypeOf(v.field).Elem())
+			if err := Array(back.Interface()).Scan(out); err != nil || !reflect.DeepEqual(back.Elem().Interface(), reflect.ValueOf(v.field).Elem().Interface()) { t.Errorf("Unexpected result (round trip): got %v, %v", back.Elem(), err) }
+		})
+	}
+}
+
+type X11 struct {
+	Id    int64    `dml:"id"`
+	Tags  []string `dml:"tags"`
+	Codes []int    `dml:"codes,array"`
+	Raw   []byte   `dml:"raw"`
+}
+
+func Test_ArrayColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	// tags is detected from its type name; codes has no metadata worth mentioning, but is tagged.
+	query := "SELECT id, tags, codes, raw FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRowsWithColumnDefinition(
+			mock.NewColumn("id").OfType("INT8", int64(0)),
+			mock.NewColumn("tags").OfType("_TEXT", []byte(nil)),
+			mock.NewColumn("codes").OfType("", []byte(nil)),
+			mock.NewColumn("raw").OfType("BYTEA", []byte(nil)),
+		).
+		AddRow(int64(1), []byte(`{a,"b c"}`), []byte(`{1,2}`), []byte(`{x}`)),
+	)
+
+	var xs []X11
+	rows, _ := X(db.Query(query))
+	if err := ScanArray(rows, &xs); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	rows.Close()
+
+	expected := []X11{{1, []string{"a", "b c"}, []int{1, 2}, []byte(`{x}`)}}
+	if !reflect.DeepEqual(xs, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", xs, expected) }
+
+	if !isArrayTypeName("int8[]") || isArrayTypeName("_") || isArrayTypeName("TEXT") { t.Errorf("Unexpected result (isArrayTypeName)") }
+}
+
+func Test_parseComposite(t *testing.T) {
+	testcases := map[string]struct{
+		in string
+		out []arrayElem
+		err string
+	}{
+		"simple":  {`(1,abc,t)`, []arrayElem{{value: "1"}, {value: "abc"}, {value: "t"}}, ""},
+		"nulls":   {`(,"",)`, []arrayElem{{null: true}, {value: ""}, {null: true}}, ""},
+		"quoted":  {`("a,b","c""d","e\\f")`, []arrayElem{{value: "a,b"}, {value: `c"d`}, {value: `e\f`}}, ""},
+		"spaces":  {`( a ,b)`, []arrayElem{{value: " a "}, {value: "b"}}, ""},
+		"mixed":   {`(a"b c"d)`, []arrayElem{{value: "ab cd"}}, ""},
+		"nested":  {`(1,"(2,x)")`, []arrayElem{{value: "1"}, {value: "(2,x)"}}, ""},
+		"open":    {`(1,2`, nil, "unterminated composite"},
+		"trailing":{`(1)x`, nil, "unexpected trailing characters"},
+		"paren":   {`1,2`, nil, "expected '('"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			out, err := parseComposite(v.in)
+			if v.err == "" && err != nil { t.Errorf("Unexpected return value (parseComposite): got %v, expected nil", err) }
+			if v.err != "" && (err == nil || !strings.Contains(err.Error(), v.err)) { t.Errorf("Unexpected return value (parseComposite): got %v, expected '%s' error", err, v.err) }
+			if !reflect.DeepEqual(out, v.out) { t.Errorf("Unexpected result (parseComposite): got %+v, expected %+v", out, v.out) }
+		})
+	}
+}
+
+type point struct {
+	X int `dml:"x"`
+	Y int `dml:"y"`
+}
+
+type shape struct {
+	Name    string    `dml:"name"`
+	Origin  point     `dml:"origin"`
+	Corners []int     `dml:"corners"`
+	Note    *string   `dml:"note"`
+	Seen    time.Time `dml:"seen"`
+}
+
+type X12 struct {
+	Id    int64              `dml:"id"`
+	Shape *shape             `dml:"shape,composite"`
+	Where point              `dml:"where,composite=y;extra;x"`
+	Attrs map[string]*string `dml:"attrs,hstore"`
+}
+
+func Test_Composite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT id, shape, where, attrs FROM table"
+	mock.ExpectQuery(query).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "shape", "where", "attrs"}).
+		AddRow(int64(1), []byte(`("a b","(1,2)","{3,4}",,"2024-01-02 03:04:05+00")`), `(5,ignored,6)`, `"k"=>"v", "n"=>NULL`).
+		AddRow(int64(2), nil, nil, nil),
+	)
+
+	var xs []X12
+	rows, _ := X(db.Query(query))
+	if err := ScanArray(rows, &xs); err != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, expected nil", err) }
+	rows.Close()
+
+	v := "v"
+	expected := []X12{
+		{1, &shape{"a b", point{1, 2}, []int{3, 4}, nil, time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 0))}, point{6, 5}, map[string]*string{"k": &v, "n": nil}},
+		{2, nil, point{}, nil},
+	}
+	if len(xs) != 2 || !reflect.DeepEqual(xs[1], expected[1]) || xs[0].Id != 1 || !reflect.DeepEqual(xs[0].Where, expected[0].Where) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", xs, expected) }
+	if s := xs[0].Shape; s == nil || s.Name != "a b" || s.Origin != (point{1, 2}) || !reflect.DeepEqual(s.Corners, []int{3, 4}) || s.Note != nil || !s.Seen.Equal(expected[0].Shape.Seen) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", xs[0].Shape, expected[0].Shape) }
+	if a := xs[0].Attrs; len(a) != 2 || *a["k"] != "v" || a["n"] != nil { t.Errorf("Unexpected result (ScanArray): got %v, expected k=v and n=NULL", a) }
+
+	// whatever is written can be read back.
+	note := `say "hi"`
+	x := X12{Shape: &shape{"", point{-1, 0}, nil, &note, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, Where: point{7, 8}}
+	out, err := Composite(&x.Shape).Value()
+	if err != nil || out != `("","(-1,0)",,"say \"hi\"",2024-01-02T00:00:00Z)` { t.Errorf("Unexpected return value (Value): got %v, %v", out, err) }
+	var back *shape
+	if err := Composite(&back).Scan(out); err != nil || !reflect.DeepEqual(back, x.Shape) { t.Errorf("Unexpected result (round trip): got %+v, %v; expected %+v", back, err, x.Shape) }
+	if out, err = Composite(&x.Where, "y", "extra", "x").Value(); err != nil || out != "(8,,7)" { t.Errorf("Unexpected return value (Value): got %v, %v; expected (8,,7)", out, err) }
+	if out, err = Composite(&back).Value(); out != `("","(-1,0)",,"say \"hi\"",2024-01-02T00:00:00Z)` { t.Errorf("Unexpected return value (Value): got %v, %v", out, err) }
+	back = nil
+	if out, err = Composite(&back).Value(); out != nil || err != nil { t.Errorf("Unexpected return value (Value): got %v, %v; expected NULL", out, err) }
+
+	if err := Composite(&x.Where).Scan(`(1)`); err == nil || !strings.Contains(err.Error(), "composite has 1 attributes, but dml.point has 2 fields") { t.Errorf("Unexpected return value (Scan): got %v, expected attribute count error", err) }
+	if err := Composite(&x.Where, "x").Scan(`(1,2)`); err == nil || !strings.Contains(err.Error(), "but 1 were declared") { t.Errorf("Unexpected return value (Scan): got %v, expected attribute count error", err) }
+	if err := Composite(&x.Where).Scan(`(a,1)`); err == nil || !strings.Contains(err.Error(), "attribute 0 (x)") { t.Errorf("Unexpected return value (Scan): got %v, expected conversion error", err) }
+}
+
+type dbPoint struct {
+	X int `db:"x"`
+	Y int `db:"y"`
+}
+
+type dbShape struct {
+	Name   string  `db:"name"`
+	Origin dbPoint `db:"origin"`
+}
+
+type X25 struct {
+	Id    int64   `db:"id"`
+	Shape dbShape `dml:"shape,composite"`
+}
+
+func Test_CompositeMapper(t *testing.T) {
+	m := NewMapper()
+	m.TagKeys = []string{"dml", "db"}
+
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "shape"}).AddRow(int64(3), `(a,"(1,2)")`))
+	rows, _ := X(db.Query("SELECT"))
+	defer rows.Close()
+	rows.Next()
+
+	var x X25
+	err = m.Scan(rows, &x)
+	if expected := (X25{3, dbShape{"a", dbPoint{1, 2}}}); err != nil || x != expected { t.Errorf("Unexpected result (Mapper.Scan): got %+v, %v, expected %+v", x, err, expected) }
+	if out, err := m.Composite(&x.Shape).Value(); err != nil || out != `(a,"(1,2)")` { t.Errorf("Unexpected return value (Mapper.Composite.Value): got %v, %v", out, err) }
+
+	// DefaultMapper doesn't read db tags, so finds no fields.
+	if err := Composite(&x.Shape).Scan(`(a,"(1,2)")`); err == nil || !strings.Contains(err.Error(), "dml.dbShape has 0 fields") { t.Errorf("Unexpected return value (Composite.Scan): got %v, expected a field count error", err) }
+}
+
+func Test_Hstore(t *testing.T) {
+	testcases := map[string]struct{
+		in string
+		keys []string
+		values []arrayElem
+		err string
+	}{
+		"empty":    {``, nil, nil, ""},
+		"quoted":   {`"a"=>"1", "b c"=>"x\"y"`, []string{"a", "b c"}, []arrayElem{{value: "1"}, {value: `x"y`}}, ""},
+		"unquoted": {`a=>1,b => NULL, c=>"NULL"`, []string{"a", "b", "c"}, []arrayElem{{value: "1"}, {value: "NULL", null: true}, {value: "NULL"}}, ""},
+		"arrow":    {`"a"="1"`, nil, nil, "expected '=>'"},
+		"comma":    {`"a"=>"1" "b"=>"2"`, nil, nil, "expected ','"},
+		"value":    {`"a"=>`, nil, nil, "expected value"},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			keys, values, err := parseHstore(v.in)
+			if v.err == "" && err != nil { t.Errorf("Unexpected return value (parseHstore): got %v, expected nil", err) }
+			if v.err != "" && (err == nil || !strings.Contains(err.Error(), v.err)) { t.Errorf("Unexpected return value (parseHstore): got %v, expected '%s' error", err, v.err) }
+			if !reflect.DeepEqual(keys, v.keys) || !reflect.DeepEqual(values, v.values) { t.Errorf("Unexpected result (parseHstore): got %v, %+v; expected %v, %+v", keys, values, v.keys, v.values) }
+		})
+	}
+
+	m := map[string]string{"b": `x"y`, "a": "1"}
+	out, err := Hstore(&m).Value()
+	if err != nil || out != `"a"=>"1", "b"=>"x\"y"` { t.Errorf("Unexpected return value (Value): got %v, %v", out, err) }
+	var back map[string]string
+	if err := Hstore(&back).Scan(out); err != nil || !reflect.DeepEqual(back, m) { t.Errorf("Unexpected result (round trip): got %v, %v; expected %v", back, err, m) }
+	if err := Hstore(&back).Scan(`a=>NULL`); err == nil || !strings.Contains(err.Error(), `hstore key "a": NULL cannot be stored in string`) { t.Errorf("Unexpected return value (Scan): got %v, expected NULL error", err) }
+
+	var ints []int
+	if err := Hstore(&ints).Scan(`a=>1`); err == nil { t.Errorf("Unexpected return value (Scan): got nil, expected error for slice") }
+}
+
+type Base struct {
+	Id   int64  `dml:"id"`
+	Kind string `dml:"kind,default=plain"`
+}
+
+type X13 struct {
+	*Base
+
+	Name string `dml:"name"`
+}
+
+type hidden struct {
+	Secret string `dml:"secret"`
+}
+
+type X14 struct {
+	*hidden
+}
+
+type Node struct {
+	*Node
+	X int `dml:"x"`
+}
+
+type Outer struct {
+	Inner
+	Y int `dml:"y"`
+}
+
+type Inner struct {
+	*Outer
+}
+
+func Test_PointerEmbedded(t *testing.T) {
+	cache, err := DefaultMapper.buildFieldCacheEntryForType(reflect.TypeOf(X13{}), nil)
+	if err != nil || !reflect.DeepEqual(cache.Names, []string{"id", "kind", "name"}) || !reflect.DeepEqual(cache.Indirect, []bool{true, true, false}) { t.Errorf("Unexpected result (buildFieldCacheEntryForType): got %+v, %v", cache, err) }
+
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	scan := func(columns []string, values []driver.Value, into ScanInto) error {
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(columns).AddRow(values...))
+		rows, _ := X(db.Query("SELECT"))
+		defer rows.Close()
+		rows.Next()
+		return Scan(rows, into)
+	}
+
+	// none of the embedded struct's columns are present, so it stays nil.
+	var x X13
+	if err := scan([]string{"name"}, []driver.Value{"a"}, &x); err != nil || x.Base != nil || x.Name != "a" { t.Errorf("Unexpected result (Scan): got %+v, %v; expected nil Base", x, err) }
+
+	// one is, so it is allocated, and its other fields receive their defaults.
+	x = X13{}
+	if err := scan([]string{"name", "id"}, []driver.Value{"b", int64(3)}, &x); err != nil || x.Base == nil || *x.Base != (Base{3, "plain"}) || x.Name != "b" { t.Errorf("Unexpected result (Scan): got %+v (%+v), %v; expected allocated Base", x, x.Base, err) }
+
+	// an existing embedded struct is scanned into in place.
+	base := &Base{Id: 1, Kind: "old"}
+	x = X13{Base: base}
+	if err := scan([]string{"kind"}, []driver.Value{nil}, &x); err != nil || x.Base != base || *base != (Base{1, "plain"}) { t.Errorf("Unexpected result (Scan): got %+v, %v; expected existing Base", base, err) }
+
+	var y X14
+	if err := scan([]string{"secret"}, []driver.Value{"s"}, &y); err == nil || !strings.Contains(err.Error(), "cannot allocate embedded *dml.hidden") { t.Errorf("Unexpected return value (Scan): got %v, expected unexported embedded error", err) }
+
+	// structs which embed pointers to themselves can't be flattened.
+	if err := Register(Node{}); err == nil || !strings.Contains(err.Error(), "dml.Node embeds itself") { t.Errorf("Unexpected return value (Register): got %v, expected a cycle error", err) }
+	if err := Register(Outer{}); err == nil || !strings.Contains(err.Error(), "dml.Outer embeds itself") { t.Errorf("Unexpected return value (Register): got %v, expected a cycle error", err) }
+
+	if f, err := fieldByIndex(reflect.ValueOf(&X13{}).Elem(), []int{0, 1}, false); f.IsValid() || err != nil { t.Errorf("Unexpected return value (fieldByIndex): got %v, %v; expected zero Value", f, err) }
+}
+
+type X15 struct {
+	Username string `dml:"username|user_name|login"`
+	Other    string `dml:"user_name"`
+}
+
+func Test_Aliases(t *testing.T) {
+	fields := func() (*X15, NamedFields) {
+		x := &X15{}
+		f, err := GetFieldsFrom(x)
+		if err != nil { t.Fatalf("Unexpected return value (GetFieldsFrom): got %v, expected nil", err) }
+		return x, f
+	}
+
+	// pad the field list so that the hashed branch of BuildMap is taken too.
+	wide := make([]string, 20)
+	for i := range wide { wide[i] = fmt.Sprintf("c%d", i) }
+
+	testcases := map[string]struct{
+		columns []string
+		out ScanMap
+	}{
+		"first":      {[]string{"username"}, ScanMap{0}},
+		"second":     {[]string{"user_name"}, ScanMap{0}},
+		"precedence": {[]string{"login", "user_name", "username"}, ScanMap{-1, 1, 0}},
+		"claimed":    {[]string{"login", "user_name"}, ScanMap{-1, 0}},
+		"none":       {[]string{"email"}, ScanMap{-1}},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			_, f := fields()
+			m, err := BuildMap(&RowMock{columns: v.columns}, f)
+			if err != nil || !reflect.DeepEqual(m, v.out) { t.Errorf("Unexpected return value (BuildMap, linear): got %v, %v; expected %v", m, err, v.out) }
+
+			for _, c := range wide { f.Push(c, new(string)) }
+			m, err = BuildMap(&RowMock{columns: append(append([]string(nil), wide...), v.columns...)}, f)
+			if err != nil || !reflect.DeepEqual(m[len(wide):], v.out) { t.Errorf("Unexpected return value (BuildMap, hashed): got %v, %v; expected %v", m[len(wide):], err, v.out) }
+		})
+	}
+
+	x, _ := fields()
+	if err := Scan(&RowMock{columns: []string{"user_name", "username"}, values: []string{"old", "new"}}, x); err != nil || x.Username != "new" || x.Other != "old" { t.Errorf("Unexpected result (Scan): got %+v, %v", x, err) }
+	if a := (FieldTag{Name: "a|b"}).Aliases(); !reflect.DeepEqual(a, []string{"a", "b"}) { t.Errorf("Unexpected return value (Aliases): got %v", a) }
+}
+
+// cachedTypes counts the types in DefaultMapper's cache.
+func cachedTypes() (n int) {
+	DefaultMapper.cache.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+type X16 struct {
+	Broken string `dml:"broken,json,array"`
+}
+
+func Test_Register(t *testing.T) {
+	ResetCache()
+	if n := cachedTypes(); n != 0 { t.Errorf("Unexpected state (ResetCache): got %d cached entries", n) }
+
+	err := Register(X13{}, &X1{}, reflect.TypeOf(Z{}))
+	if err != nil { t.Errorf("Unexpected return value (Register): got %v, expected nil", err) }
+	for _, v := range []interface{}{X13{}, X1{}, Z{}} {
+		if _, ok := DefaultMapper.cache.Load(reflect.TypeOf(v)); !ok { t.Errorf("Expected %T to be cached", v) }
+	}
+
+	err = Register(X12{}, X16{}, 7)
+	if err == nil || !strings.Contains(err.Error(), "registering dml.X16: ") || !strings.Contains(err.Error(), "can't be combined") || !strings.Contains(err.Error(), "int is not a struct") { t.Errorf("Unexpected return value (Register): got %v", err) }
+	if errs, ok := err.(RegisterError); !ok || len(errs) != 2 { t.Errorf("Unexpected return value (Register): got %#v, expected a RegisterError with 2 errors", err) }
+	if _, ok := DefaultMapper.cache.Load(reflect.TypeOf(X12{})); !ok { t.Errorf("Expected X12 to be cached despite the other failures") }
+	if err := Register(X16{}); err == nil || !strings.Contains(err.Error(), "can't be combined") { t.Errorf("Expected X16's error to be cached, but got %v", err) }
+
+	ResetCache()
+	if n := cachedTypes(); n != 0 { t.Errorf("Unexpected state (ResetCache): got %d cached entries", n) }
+}
+
+func Test_Describe(t *testing.T) {
+	d, err := Describe(&X13{})
+	if err != nil || len(d) != 3 { t.Fatalf("Unexpected return value (Describe): got %+v, %v", d, err) }
+	if d[1].Name != "kind" || !reflect.DeepEqual(d[1].Path, []string{"Base", "Kind"}) || !reflect.DeepEqual(d[1].Index, []int{0, 1}) || d[1].Type != reflect.TypeOf("") || d[1].Tag.Default != "plain" || d[1].FromGetFields { t.Errorf("Unexpected description: got %+v", d[1]) }
+
+	d, err = Describe(reflect.TypeOf(Z{}))
+	if err != nil || len(d) != 7 { t.Fatalf("Unexpected return value (Describe): got %+v, %v", d, err) }
+	expected := []struct{
+		name string
+		path []string
+		get bool
+	}{
+		{"value3", []string{"E1", "Test"}, false},
+		{"value3", []string{"E2", "E1", "Test"}, false},
+		{"value4", []string{"E2", "Test"}, false},
+		{"value1", []string{"Test1"}, false},
+		{"value2", []string{"Test2"}, false},
+		{"testing1", []string{"E2", "Test"}, true},
+		{"testing2", []string{"private"}, true},
+	}
+	for i, e := range expected {
+		if d[i].Name != e.name || !reflect.DeepEqual(d[i].Path, e.path) || d[i].FromGetFields != e.get || d[i].Type != reflect.TypeOf("") { t.Errorf("Unexpected description %d: got %+v, expected %+v", i, d[i], e) }
+	}
+
+	// GetFields columns are found behind embedded pointers, if GetFields allocates them.
+	d, err = Describe(X22{})
+	if err != nil || len(d) != 2 { t.Fatalf("Unexpected return value (Describe): got %+v, %v", d, err) }
+	if !reflect.DeepEqual(d[1].Path, []string{"Extra", "Note"}) || !reflect.DeepEqual(d[1].Index, []int{0, 0}) || !d[1].FromGetFields { t.Errorf("Unexpected description: got %+v", d[1]) }
+
+	if _, err := Describe(X16{}); err == nil { t.Errorf("Expected an error describing X16") }
+	if _, err := Describe(nil); err == nil { t.Errorf("Expected an error describing nil") }
+}
+
+type Extra struct {
+	Note string
+}
+
+type X22 struct {
+	*Extra
+	Id int64 `dml:"id"`
+}
+
+func (x *X22) GetFields() (NamedFields, error) {
+	if x.Extra == nil { x.Extra = &Extra{} }
+	var n NamedFields
+	n.Push("note", &x.Note)
+	return n, nil
+}
+
+type X17 struct {
+	A string `dml:"a"`
+	B int    `dml:"b,default=1"`
+}
+
+func Test_ConcurrentCache(t *testing.T) {
+	ResetCache()
+	var wg sync.WaitGroup
+	results := make([]NamedFieldsMaker, 32)
+	errs := make([]error, 32)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i % 2 == 0 {
+				results[i], errs[i] = DefaultMapper.getFieldCachesFor(reflect.TypeOf(X17{}))
+			} else {
+				_, errs[i] = DefaultMapper.getFieldCachesFor(reflect.TypeOf(X16{}))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range results {
+		if i % 2 == 0 && (errs[i] != nil || !reflect.DeepEqual(results[i].(fieldCacheEntry).Names, []string{"a", "b"})) { t.Errorf("Unexpected return value %d (getFieldCachesFor): got %+v, %v", i, results[i], errs[i]) }
+		if i % 2 == 1 && (errs[i] == nil || errs[i].Error() != errs[1].Error()) { t.Errorf("Unexpected return value %d (getFieldCachesFor): got %v, expected %v", i, errs[i], errs[1]) }
+	}
+	if n := cachedTypes(); n != 2 { t.Errorf("Unexpected state (DefaultMapper.cache): got %d cached entries, expected 2", n) }
+}
+
+type X18 struct {
+	Id      int64     `dml:"id" other:"ident"`
+	Name    string    `dml:"name"`
+	Created time.Time `dml:"created" other:"ts"`
+}
+
+func Test_Mapper(t *testing.T) {
+	m := NewMapper()
+	m.TagKeys = []string{"other"}
+	m.Normalize = strings.ToLower
+	AddConverter(m.Converters, func(s int64) (time.Time, error) { return time.Unix(s, 0).UTC(), nil })
+
+	fields, err := m.GetFieldsFrom(&X18{})
+	if err != nil || !reflect.DeepEqual(fields.Names, []string{"ident", "ts"}) { t.Errorf("Unexpected return value (Mapper.GetFieldsFrom): got %v, %v", fields.Names, err) }
+	if _, ok := DefaultMapper.cache.Load(reflect.TypeOf(X18{})); ok { t.Errorf("Expected the mapper's cache to be separate from DefaultMapper's") }
+
+	m2, err := m.BuildMap(&RowMock{columns: []string{"TS", "Ident", "name"}}, fields)
+	if err != nil || !reflect.DeepEqual(m2, ScanMap{1, 0, -1}) { t.Errorf("Unexpected return value (Mapper.BuildMap): got %v, %v", m2, err) }
+	m2, err = BuildMap(&RowMock{columns: []string{"TS", "Ident"}}, fields)
+	if err != nil || !reflect.DeepEqual(m2, ScanMap{-1, -1}) { t.Errorf("Unexpected return value (BuildMap): got %v, %v", m2, err) }
+
+	db, mock, err := sqlmock.New()
+	if err != nil { t.Skipf("couldn't create mock DB: %v", err) }
+	defer db.Close()
+
+	query := "SELECT IDENT, TS FROM table"
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(query).WillReturnRows(
+			sqlmock.NewRowsWithColumnDefinition(
+				mock.NewColumn("IDENT").OfType("BIGINT", int64(0)),
+				mock.NewColumn("TS").OfType("BIGINT", int64(0)),
+			).AddRow(int64(3), int64(86400)),
+		)
+	}
+
+	var xs []X18
+	rows, _ := X(db.Query(query))
+	if err := m.ScanArray(rows, &xs); err != nil || !reflect.DeepEqual(xs, []X18{{Id: 3, Created: time.Unix(86400, 0).UTC()}}) { t.Errorf("Unexpected result (Mapper.ScanArray): got %+v, %v", xs, err) }
+	rows.Close()
+
+	// DefaultConverters doesn't know how to make a time from an integer.
+	m.Converters = nil
+	m.ValidateTypes = true
+	var x X18
+	rows, _ = X(db.Query(query))
+	rows.Next()
+	err = m.Scan(rows, &x)
+	if _, ok := err.(TypeMismatchError); !ok { t.Errorf("Unexpected return value (Mapper.Scan): got %v, expected a TypeMismatchError", err) }
+	rows.Close()
+}
+
+type X19 struct {
+	Id      int64  `gorm:"column:user_id;primaryKey" db:"id"`
+	Name    string `db:"name,omitempty"`
+	Email   string `dml:"email" db:"mail"`
+	Ignored string `db:"-" gorm:"-"`
+	Derived string `gorm:"not null"`
+}
+
+func Test_TagKeys(t *testing.T) {
+	testcases := map[string]struct{
+		keys []string
+		parser TagParser
+		names []string
+	}{
+		"dml":      {[]string{"dml"}, nil, []string{"email"}},
+		"db":       {[]string{"db"}, nil, []string{"id", "name", "mail"}},
+		"gorm":     {[]string{"gorm"}, nil, []string{"user_id"}},
+		"fallback": {[]string{"dml", "gorm", "db"}, nil, []string{"user_id", "name", "email"}},
+		"parser":   {[]string{"db"}, func(key, value string) (FieldTag, bool, error) { return FieldTag{Name: key + "." + value}, true, nil }, []string{"db.id", "db.name,omitempty", "db.mail", "db.-"}},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			m := NewMapper()
+			m.TagKeys, m.TagParser = v.keys, v.parser
+			fields, err := m.GetFieldsFrom(&X19{})
+			if err != nil || !reflect.DeepEqual(fields.Names, v.names) { t.Errorf("Unexpected return value (Mapper.GetFieldsFrom): got %v, %v; expected %v", fields.Names, err, v.names) }
+		})
+	}
+
+	m := NewMapper()
+	m.TagKeys = []string{"db", "dml"}
+	if err := m.Register(X16{}); err == nil || !strings.Contains(err.Error(), "can't be combined") { t.Errorf("Unexpected return value (Mapper.Register): got %v, expected an error", err) }
+
+	tag, ok, err := ParseGormTag("primaryKey; Column:id")
+	if err != nil || !ok || tag.Name != "id" { t.Errorf("Unexpected return value (ParseGormTag): got %+v, %v, %v", tag, ok, err) }
+}
+
+type X20 struct {
+	*Base
+
+	Name     string         `dml:"name|username"`
+	Note     *string        `dml:"note"`
+	Score    float64        `dml:"score"`
+	Created  time.Time      `dml:"created"`
+	Settings settings       `dml:"settings,json"`
+	Tags     []string       `dml:"tags,array"`
+	Nick     sql.NullString `dml:"nick"`
+}
+
+func Test_Export(t *testing.T) {
+	note := "a, \"quoted\" note"
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []X20{
+		{Base: &Base{Id: 1, Kind: "plain"}, Name: "alice", Note: &note, Score: 1.5, Created: created, Settings: settings{Theme: "dark"}, Tags: []string{"a", "b c"}, Nick: sql.NullString{String: "al", Valid: true}},
+		{Name: "bob", Created: created},
+	}
+
+	var buf strings.Builder
+	if err := WriteCSV(&buf, rows); err != nil { t.Fatalf("Unexpected return value (WriteCSV): got %v, expected nil", err) }
+	expected := `id,kind,name,note,score,created,settings,tags,nick
+1,plain,alice,"a, ""quoted"" note",1.5,2024-01-02T03:04:05Z,"{""theme"":""dark"",""size"":0}","{a,""b c""}",al
+,,bob,,0,2024-01-02T03:04:05Z,"{""theme"":"""",""size"":0}",,
+`
+	if buf.String() != expected { t.Errorf("Unexpected result (WriteCSV): got\n%s\nexpected\n%s", buf.String(), expected) }
+
+	buf.Reset()
+	if err := WriteJSONLines(&buf, &rows); err != nil { t.Fatalf("Unexpected return value (WriteJSONLines): got %v, expected nil", err) }
+	expected = `{"id":1,"kind":"plain","name":"alice","note":"a, \"quoted\" note","score":1.5,"created":"2024-01-02T03:04:05Z","settings":{"theme":"dark","size":0},"tags":["a","b c"],"nick":"al"}
+{"id":null,"kind":null,"name":"bob","note":null,"score":0,"created":"2024-01-02T03:04:05Z","settings":{"theme":"","size":0},"tags":null,"nick":null}
+`
+	if buf.String() != expected { t.Errorf("Unexpected result (WriteJSONLines): got\n%s\nexpected\n%s", buf.String(), expected) }
+
+	buf.Reset()
+	type row struct {
+		Id   int     `dml:"id"`
+		Name string  `dml:"name"`
+		Note *string `dml:"note"`
+	}
+	if err := WriteTable(&buf, []*row{{1, "alice", &note}, {22, "bøb", nil}}); err != nil { t.Fatalf("Unexpected return value (WriteTable): got %v, expected nil", err) }
+	expected = `id  name   note
+--  -----  ----------------
+1   alice  a, "quoted" note
+22  bøb    NULL
+`
+	if buf.String() != expected { t.Errorf("Unexpected result (WriteTable): got\n%s\nexpected\n%s", buf.String(), expected) }
+
+	buf.Reset()
+	if err := WriteCSV(&buf, []row(nil)); err != nil || buf.String() != "id,name,note\n" { t.Errorf("Unexpected result (WriteCSV): got %q, %v", buf.String(), err) }
+	if err := WriteCSV(&buf, row{}); err == nil { t.Errorf("Expected an error exporting a struct which isn't in a slice") }
+	if err := WriteCSV(&buf, []*row{nil}); err == nil { t.Errorf("Expected an error exporting a nil row") }
+}
+
+func Test_ColumnValues(t *testing.T) {
+	note := "hi"
+	x := X20{Name: "a", Note: &note, Score: 2, Tags: []string{"x"}}
+	names, values, err := ColumnValues(&x)
+	expected := []driver.Value{nil, nil, "a", "hi", 2.0, time.Time{}, []byte(`{"theme":"","size":0}`), "{x}", nil}
+	if err != nil || !reflect.DeepEqual(names, []string{"id", "kind", "name", "note", "score", "created", "settings", "tags", "nick"}) || !reflect.DeepEqual(values, expected) { t.Errorf("Unexpected return value (ColumnValues): got %v, %#v, %v", names, values, err) }
+
+	x.Base = &Base{Id: 4}
+	_, values, err = ColumnValues(&x)
+	if err != nil || values[0] != int64(4) || values[1] != "" { t.Errorf("Unexpected return value (ColumnValues): got %#v, %v", values, err) }
+}
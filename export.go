@@ -0,0 +1,211 @@
+package dml
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// WriteCSV writes rows, a slice of (or pointer to a slice of) structs or pointers to structs, to w
+// as CSV. The header names the columns the structs are scanned from, in the order dml finds them,
+// using the first alias of each (see BuildMap), and each struct is a record. Values are written as
+// their text, as they would be passed to a database: fields with the json, array, hstore and
+// composite tag options as JSON or literals, times as RFC 3339, and NULL as an empty cell.
+func WriteCSV(w io.Writer, rows interface{}) error {
+	return DefaultMapper.WriteCSV(w, rows)
+}
+
+// WriteJSONLines writes rows (see WriteCSV) to w as JSON Lines: one object per struct, whose keys
+// are the columns, in order. Values are encoded with encoding/json, except that driver.Valuer
+// implementations (such as sql.NullString) are encoded as the value they produce, and fields with
+// the json tag option are embedded as they are.
+func WriteJSONLines(w io.Writer, rows interface{}) error {
+	return DefaultMapper.WriteJSONLines(w, rows)
+}
+
+// WriteTable writes rows (see WriteCSV) to w as a text table, with a header and the values of each
+// column aligned, for reports and logs. NULL is written as NULL.
+func WriteTable(w io.Writer, rows interface{}) error {
+	return DefaultMapper.WriteTable(w, rows)
+}
+
+// ColumnValues returns the columns into, a pointer to a struct, is scanned from (using the first
+// alias of each), along with the values of the fields they are scanned into, as they would be
+// passed to a database driver: driver.Valuer implementations (including the field wrappers of the
+// json, array, hstore and composite tag options) produce their values, pointers are followed, nil
+// pointers are NULL, and everything else is converted by driver.DefaultParameterConverter.
+func ColumnValues(into ScanInto) ([]string, []driver.Value, error) {
+	return DefaultMapper.ColumnValues(into)
+}
+
+// Mapper.ColumnValues is ColumnValues, using m to find the columns.
+func (m *Mapper) ColumnValues(into ScanInto) ([]string, []driver.Value, error) {
+	fields, err := m.GetFieldsFrom(into)
+	if err != nil { return nil, nil, err }
+
+	names := make([]string, len(fields.Names))
+	values := make([]driver.Value, len(fields.Fields))
+	for i, field := range fields.Fields {
+		names[i], _, _ = splitAlias(fields.Names[i])
+		if field = resolveField(field); field == nil { continue }
+		if d, ok := field.(*defaultScanner); ok { field = d.field }
+		if values[i], err = driver.DefaultParameterConverter.ConvertValue(field); err != nil { return nil, nil, fmt.Errorf("column %q: %w", names[i], err) }
+	}
+	return names, values, nil
+}
+
+// Mapper.WriteCSV is WriteCSV, using m to find the columns.
+func (m *Mapper) WriteCSV(w io.Writer, rows interface{}) error {
+	names, records, err := m.exportRows(rows)
+	if err != nil { return err }
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(names); err != nil { return err }
+	record := make([]string, len(names))
+	for i, fields := range records {
+		for j, field := range fields {
+			text, _, err := m.exportText(field)
+			if err != nil { return fmt.Errorf("row %d, column %q: %w", i, names[j], err) }
+			record[j] = text
+		}
+		if err = cw.Write(record); err != nil { return err }
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Mapper.WriteJSONLines is WriteJSONLines, using m to find the columns.
+func (m *Mapper) WriteJSONLines(w io.Writer, rows interface{}) error {
+	names, records, err := m.exportRows(rows)
+	if err != nil { return err }
+
+	keys := make([][]byte, len(names))
+	for i, n := range names {
+		if keys[i], err = json.Marshal(n); err != nil { return err }
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, fields := range records {
+		bw.WriteByte('{')
+		for j, field := range fields {
+			value, err := exportJSON(field)
+			if err != nil { return fmt.Errorf("row %d, column %q: %w", i, names[j], err) }
+			if j > 0 { bw.WriteByte(',') }
+			bw.Write(keys[j])
+			bw.WriteByte(':')
+			bw.Write(value)
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+// Mapper.WriteTable is WriteTable, using m to find the columns.
+func (m *Mapper) WriteTable(w io.Writer, rows interface{}) error {
+	names, records, err := m.exportRows(rows)
+	if err != nil { return err }
+
+	cells := make([][]string, len(records) + 2)
+	cells[0] = names
+	cells[1] = make([]string, len(names))
+	widths := make([]int, len(names))
+	for i, fields := range records {
+		cells[i + 2] = make([]string, len(fields))
+		for j, field := range fields {
+			text, null, err := m.exportText(field)
+			if err != nil { return fmt.Errorf("row %d, column %q: %w", i, names[j], err) }
+			if null { text = "NULL" }
+			cells[i + 2][j] = text
+		}
+	}
+	for _, row := range cells {
+		for j, c := range row {
+			if n := utf8.RuneCountInString(c); n > widths[j] { widths[j] = n }
+		}
+	}
+	for j := range names { cells[1][j] = strings.Repeat("-", widths[j]) }
+
+	bw := bufio.NewWriter(w)
+	for _, row := range cells {
+		var line strings.Builder
+		for j, c := range row {
+			if j > 0 { line.WriteString("  ") }
+			line.WriteString(c)
+			line.WriteString(strings.Repeat(" ", widths[j] - utf8.RuneCountInString(c)))
+		}
+		bw.WriteString(strings.TrimRight(line.String(), " "))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// Mapper.exportRows finds the columns of rows (see WriteCSV), and the fields of each of its elements.
+func (m *Mapper) exportRows(rows interface{}) ([]string, [][]interface{}, error) {
+	v := reflect.ValueOf(rows)
+	for v.Kind() == reflect.Ptr && !v.IsNil() { v = v.Elem() }
+	if v.Kind() != reflect.Slice { return nil, nil, fmt.Errorf("cannot export %T, which is not a slice", rows) }
+
+	// the columns come from a zero value, so that empty slices still have a header.
+	t := v.Type().Elem()
+	if t.Kind() == reflect.Ptr { t = t.Elem() }
+	zero, err := m.GetFieldsFrom(reflect.New(t).Interface())
+	if err != nil { return nil, nil, err }
+	names := make([]string, len(zero.Names))
+	for i, n := range zero.Names { names[i], _, _ = splitAlias(n) }
+
+	records := make([][]interface{}, v.Len())
+	for i := range records {
+		e := v.Index(i)
+		if e.Kind() == reflect.Ptr && e.IsNil() { return nil, nil, fmt.Errorf("cannot export row %d, which is nil", i) }
+		if e.Kind() != reflect.Ptr { e = e.Addr() }
+		fields, err := m.GetFieldsFrom(e.Interface())
+		if err != nil { return nil, nil, err }
+		if len(fields.Fields) != len(names) { return nil, nil, fmt.Errorf("row %d has %d columns, but its type has %d", i, len(fields.Fields), len(names)) }
+		records[i] = fields.Fields
+	}
+	return names, records, nil
+}
+
+// resolveField returns the field to export for a field found in a NamedFields, which is nil for
+// fields behind nil embedded pointers.
+func resolveField(field interface{}) interface{} {
+	l, ok := field.(*lazyField)
+	if !ok { return field }
+	f, _ := fieldByIndex(l.v, l.entry.Fields[l.i], false)
+	if !f.IsValid() { return nil }
+	return l.entry.render(l.i, f)
+}
+
+// Mapper.exportText renders a field found in a NamedFields as text, reporting whether it is NULL.
+func (m *Mapper) exportText(field interface{}) (string, bool, error) {
+	field = resolveField(field)
+	if field == nil { return "", true, nil }
+	return m.attributeText(field)
+}
+
+// exportJSON encodes a field found in a NamedFields as JSON.
+func exportJSON(field interface{}) ([]byte, error) {
+	field = resolveField(field)
+	if j, ok := field.(*JSONField); ok {
+		value, err := j.Value()
+		if err != nil || value == nil { return []byte("null"), err }
+		return value.([]byte), nil
+	}
+
+	field = unwrapField(field)
+	if valuer, ok := field.(driver.Valuer); ok {
+		if v := reflect.ValueOf(field); v.Kind() == reflect.Ptr && v.IsNil() { return []byte("null"), nil }
+		value, err := valuer.Value()
+		if err != nil { return nil, err }
+		if b, ok := value.([]byte); ok { value = string(b) }
+		field = value
+	}
+
+	return JSONMarshal(field)
+}
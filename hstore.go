@@ -0,0 +1,123 @@
+package dml
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// HstoreField wraps a pointer to a map with string keys whose column holds a Postgres hstore. It
+// is both a sql.Scanner, which parses the hstore's text representation into the map, and a
+// driver.Valuer, which formats the map as an hstore literal for writing.
+type HstoreField struct {
+	field interface{}
+}
+
+// Hstore wraps field, which must be a pointer to a map with string keys, so that its column is
+// parsed as a Postgres hstore literal, such as `"a"=>"1", "b"=>NULL`, when scanned. NULL stores a
+// nil map. Values are stored as database/sql would store a column holding their text (see
+// ConvertAssign), so NULL values need a value type which can hold them, such as *string. The
+// result can also be passed to Exec, where it formats the map as an hstore literal. This is what
+// the `hstore` tag option does, and can be used in GetFields implementations to the same effect.
+func Hstore(field interface{}) *HstoreField {
+	return &HstoreField{field: field}
+}
+
+// HstoreField.Scan parses src, which must be NULL, a string or a []byte, into the map.
+func (h *HstoreField) Scan(src interface{}) error {
+	dv := reflect.ValueOf(h.field).Elem()
+	if dv.Kind() != reflect.Map || dv.Type().Key().Kind() != reflect.String { return fmt.Errorf("cannot store an hstore in %v", dv.Type()) }
+	if src == nil {
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	}
+	text, ok := literalText(src)
+	if !ok { return fmt.Errorf("cannot parse hstore from %T", src) }
+
+	keys, values, err := parseHstore(text)
+	if err != nil { return err }
+	out := reflect.MakeMapWithSize(dv.Type(), len(keys))
+	for i, k := range keys {
+		ev := reflect.New(dv.Type().Elem()).Elem()
+		if err := assignElement(ev, values[i]); err != nil { return fmt.Errorf("hstore key %q: %w", k, err) }
+		out.SetMapIndex(reflect.ValueOf(k).Convert(dv.Type().Key()), ev)
+	}
+	dv.Set(out)
+	return nil
+}
+
+// HstoreField.Value formats the map as an hstore literal, with its keys in order. A nil map is
+// written as NULL.
+func (h *HstoreField) Value() (driver.Value, error) {
+	dv := reflect.ValueOf(h.field).Elem()
+	if dv.Kind() != reflect.Map || dv.Type().Key().Kind() != reflect.String { return nil, fmt.Errorf("cannot format %v as an hstore", dv.Type()) }
+	if dv.IsNil() { return nil, nil }
+
+	keys := dv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	var buf []byte
+	for i, k := range keys {
+		if i > 0 { buf = append(buf, ", "...) }
+		text, null, nested, err := elementText(dv.MapIndex(k))
+		if err == nil && nested.IsValid() { err = fmt.Errorf("cannot format %v as an hstore value", nested.Type()) }
+		if err != nil { return nil, fmt.Errorf("hstore key %q: %w", k.String(), err) }
+
+		buf = appendHstoreString(buf, k.String())
+		buf = append(buf, "=>"...)
+		if null {
+			buf = append(buf, "NULL"...)
+		} else {
+			buf = appendHstoreString(buf, text)
+		}
+	}
+	return string(buf), nil
+}
+
+// appendHstoreString appends s to buf, double quoted, with quotes and backslashes escaped.
+func appendHstoreString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' { buf = append(buf, '\\') }
+		buf = append(buf, s[i])
+	}
+	return append(buf, '"')
+}
+
+// parseHstore parses a Postgres hstore literal into its keys and values, in the order they appear.
+func parseHstore(s string) (keys []string, values []arrayElem, err error) {
+	p := &literalParser{s: s}
+	for {
+		p.skipSpace()
+		if p.pos >= len(s) { return keys, values, nil }
+
+		key, quoted, err := p.hstoreString("=")
+		if err != nil { return nil, nil, err }
+		if !quoted && key == "" { return nil, nil, p.errorf("expected key") }
+		p.skipSpace()
+		if p.pos + 1 >= len(s) || s[p.pos:p.pos + 2] != "=>" { return nil, nil, p.errorf("expected '=>'") }
+		p.pos += 2
+		p.skipSpace()
+
+		value, quoted, err := p.hstoreString(",")
+		if err != nil { return nil, nil, err }
+		if !quoted && value == "" { return nil, nil, p.errorf("expected value") }
+		keys = append(keys, key)
+		values = append(values, arrayElem{value: value, null: !quoted && strings.EqualFold(value, "NULL")})
+
+		p.skipSpace()
+		if p.pos >= len(s) { return keys, values, nil }
+		if s[p.pos] != ',' { return nil, nil, p.errorf("expected ','") }
+		p.pos++
+	}
+}
+
+// literalParser.hstoreString reads a quoted string, or an unquoted one up to whitespace or a terminator.
+func (p *literalParser) hstoreString(terminators string) (string, bool, error) {
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		s, err := p.quoted(false)
+		return s, true, err
+	}
+	return p.unquoted(terminators + " \t\n\r\v\f"), false, nil
+}
@@ -2,6 +2,8 @@ package dml
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 )
 
 // this represents a simple index based mapping from expected final position (in Scan call)
@@ -42,54 +44,139 @@ func (n *iln) yoink() (*int, *iln) {
 	}
 }
 
-// BuildMap builds a ScanMap from the provided scannable and field list.
+// splitAlias splits the first of the |-separated aliases off name, returning it, the rest, and
+// whether there are any more.
+func splitAlias(name string) (alias, rest string, more bool) {
+	if i := strings.IndexByte(name, '|'); i >= 0 { return name[:i], name[i + 1:], true }
+	return name, "", false
+}
+
+// hasAlias reports whether column is one of the |-separated aliases in name.
+func hasAlias(name, column string) bool {
+	for alias, rest, more := splitAlias(name); ; alias, rest, more = splitAlias(rest) {
+		if alias == column { return true }
+		if !more { return false }
+	}
+}
+
+// BuildMap builds a ScanMap from the provided scannable and field list. If any of the fields are
+// required, and there is no column for them, an error naming them all is returned.
+//
+// A field's name may list several aliases separated by |, such as "username|user_name", in which
+// case it takes the first unclaimed column named by any of them. The aliases are tried in order, so
+// if the result set has columns for more than one, the first alias listed wins, and the columns of
+// the others are left for other fields or discarded.
 func BuildMap(adv AdvancedScannable, fields NamedFields) (ScanMap, error) {
+	return DefaultMapper.BuildMap(adv, fields)
+}
+
+// Mapper.BuildMap is BuildMap, comparing names as m does.
+func (m *Mapper) BuildMap(adv AdvancedScannable, fields NamedFields) (ScanMap, error) {
 	names, err := adv.ColumnNames()
 	if err != nil { return nil, err }
 	
 	// special case: if columns is nil, that probably means adv is a scannableWrapper,
 	// so we want to return the special output value nil to indicate "skip the mapping step".
 	if names == nil { return nil, nil }
+
+	fieldNames := fields.Names
+	if m.Normalize != nil {
+		normalized := make([]string, len(names))
+		for i, n := range names { normalized[i] = m.Normalize(n) }
+		names, fieldNames = normalized, m.normalizeFields(fields)
+	}
+	output := mapColumns(names, fieldNames)
+
+	if len(fields.Required) != 0 {
+		if err := checkRequired(output, fields); err != nil { return nil, err }
+	}
 	
+	return output, nil
+}
+
+// mapColumns builds a ScanMap matching the column names with the field names. See BuildMap.
+func mapColumns(names, fieldNames []string) ScanMap {
 	output := make(ScanMap, len(names))
 	for i := range names { output[i] = -1 }
-	
-	if (len(names) - 5) * (len(fields.Names) - 5) > 100 {
+
+	// the linear search is quadratic but allocation-free, and the hashed lookup allocates a map
+	// entry and a list node per column. the hashed lookup only wins once both lists are fairly
+	// long; see BenchmarkBuildMap before tuning this threshold.
+	if (len(names) - 5) * (len(fieldNames) - 5) > 100 {
 		columnsByName := make(map[string]*iln)
 		for i, n := range names { columnsByName[n] = columnsByName[n].add(i) }
-		for i, n := range fields.Names {
-			var x *int
-			x, columnsByName[n] = columnsByName[n].yoink()
-			if x != nil { output[*x] = i }
+		for i, n := range fieldNames {
+			for alias, rest, more := splitAlias(n); ; alias, rest, more = splitAlias(rest) {
+				var x *int
+				x, columnsByName[alias] = columnsByName[alias].yoink()
+				if x != nil {
+					output[*x] = i
+					break
+				}
+				if !more { break }
+			}
 		}
 	} else {
 		MainLoop:
-		for i, n := range fields.Names {
-			for j, n2 := range names {
-				if output[j] != -1 { continue }
-				if n == n2 {
-					output[j] = i
-					continue MainLoop
+		for i, n := range fieldNames {
+			for alias, rest, more := splitAlias(n); ; alias, rest, more = splitAlias(rest) {
+				for j, n2 := range names {
+					if output[j] != -1 { continue }
+					if alias == n2 {
+						output[j] = i
+						continue MainLoop
+					}
 				}
+				if !more { break }
 			}
 			
 			// if we get here, that means a field is requesting a column which doesn't exist.
-			// that's okay, that field just won't be populated.
+			// that's okay, that field just won't be populated (unless it's required).
 		}
 	}
-	
-	return output, nil
+
+	return output
+}
+
+// checkRequired returns an error naming every required field in `fields` which no column maps to.
+func checkRequired(m ScanMap, fields NamedFields) error {
+	used := make([]bool, len(fields.Names))
+	for _, idx := range m {
+		if idx >= 0 { used[idx] = true }
+	}
+
+	var missing []string
+	for _, r := range fields.Required {
+		if !used[r.Index] {
+			missing = append(missing, fmt.Sprintf("%s requires column %q", r.Owner, fields.Names[r.Index]))
+		}
+	}
+
+	if len(missing) == 0 { return nil }
+	return fmt.Errorf("required columns missing from result set: %s", strings.Join(missing, ", "))
 }
 
 // NamedFields represents a list of fields and their associated names, and is used to match
-// fields to columns in the output database.
+// fields to columns in the output database. Required optionally lists fields which BuildMap
+// must find a column for.
 type NamedFields struct {
-	Names  []string
-	Fields []interface{}
+	Names    []string
+	Fields   []interface{}
+	Required []RequiredField
+}
+
+// RequiredField marks the field at Index in a NamedFields as required. Owner names the type the
+// field belongs to, for use in error messages.
+type RequiredField struct {
+	Index int
+	Owner string
 }
 
 // n.Append(other) appends NamedFields `other` object `n`.
 func (n *NamedFields) Append(other NamedFields) *NamedFields {
+	for _, r := range other.Required {
+		n.Required = append(n.Required, RequiredField{Index: r.Index + len(n.Names), Owner: r.Owner})
+	}
 	n.Names  = append(n.Names,  other.Names...)
 	n.Fields = append(n.Fields, other.Fields...)
 	return n
@@ -101,14 +188,26 @@ func (n *NamedFields) Push(name string, field interface{}) *NamedFields {
 	n.Fields = append(n.Fields, field)
 	return n
 }
+
+// n.PushRequired(name, field, owner) adds a new required field `field`, named `name`, belonging to `owner`.
+func (n *NamedFields) PushRequired(name string, field interface{}, owner string) *NamedFields {
+	n.Required = append(n.Required, RequiredField{Index: len(n.Names), Owner: owner})
+	return n.Push(name, field)
+}
+
 // BuildNamedFields builds a NamedFields from the provided list of ScanInto objects.
 func BuildNamedFields(into []ScanInto) (NamedFields, error) {
+	return DefaultMapper.BuildNamedFields(into)
+}
+
+// Mapper.BuildNamedFields is BuildNamedFields, using m to find the fields of into.
+func (m *Mapper) BuildNamedFields(into []ScanInto) (NamedFields, error) {
 	if len(into) == 0 { return NamedFields{}, errors.New("empty output object list") }
 	
-	fields, err := GetFieldsFrom(into[0])
+	fields, err := m.GetFieldsFrom(into[0])
 	if err != nil { return NamedFields{}, err }
 	for _, x := range into[1:] {
-		new_fields, new_err := GetFieldsFrom(x)
+		new_fields, new_err := m.GetFieldsFrom(x)
 		if new_err != nil { return NamedFields{}, new_err }
 		fields.Append(new_fields)
 	}
@@ -0,0 +1,41 @@
+// Package assign stores values read from text-based sources into the fields dml passes to Scan. It
+// is shared by jsonsource and csvsource, which differ only in how they parse times.
+package assign
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Value stores src into dest, which is unwrapped first if it is a dml.IndirectField. Scanners are
+// given src as-is; strings stored into a time.Time or *time.Time are parsed with parseTime, and
+// everything else is converted with dml.ConvertAssign.
+func Value(dest, src interface{}, parseTime func(string) (time.Time, error)) error {
+	if indirect, ok := dest.(dml.IndirectField); ok {
+		field, err := indirect.Field()
+		if err != nil { return err }
+		dest = field
+	}
+	if scanner, ok := dest.(sql.Scanner); ok { return scanner.Scan(src) }
+
+	str, ok := src.(string)
+	dv := reflect.ValueOf(dest)
+	if !ok || dv.Kind() != reflect.Ptr || dv.IsNil() { return dml.ConvertAssign(dest, src) }
+	dv = dv.Elem()
+	indirect := dv.Kind() == reflect.Ptr && dv.Type().Elem() == timeType
+	if dv.Type() != timeType && !indirect { return dml.ConvertAssign(dest, src) }
+
+	t, err := parseTime(str)
+	if err != nil { return err }
+	if indirect {
+		dv.Set(reflect.ValueOf(&t))
+	} else {
+		dv.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Package structcols finds the columns of a struct type from go/types information, the same way
+// the dml package finds them at runtime using reflection. It is shared by the tools which need to
+// agree with the runtime without running it.
+package structcols
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+
+	"github.com/thewug/dml"
+)
+
+// scannerType is an interface with the same method set as sql.Scanner, used to decide whether a
+// field is passed to Scan as-is or by address, as dml does at runtime.
+var scannerType = types.NewInterfaceType([]*types.Func{
+	types.NewFunc(token.NoPos, nil, "Scan", types.NewSignature(nil,
+		types.NewTuple(types.NewVar(token.NoPos, nil, "src", types.NewInterfaceType(nil, nil).Complete())),
+		types.NewTuple(types.NewVar(token.NoPos, nil, "", types.Universe.Lookup("error").Type())),
+		false)),
+}, nil).Complete()
+
+// Column is a single tagged field of a struct.
+type Column struct {
+	Tag     dml.FieldTag
+	Path    []string   // the names of the fields leading to this one, starting from the outer struct
+	Type    types.Type
+	Scanner bool       // whether the field's type implements sql.Scanner, so that it is scanned into as-is
+	Indirect bool      // whether the path to the field passes through an embedded pointer
+}
+
+// HasMethod reports whether *t has a method with the given name, declared or promoted.
+func HasMethod(t types.Type, name string) bool {
+	return types.NewMethodSet(types.NewPointer(t)).Lookup(nil, name) != nil
+}
+
+// Columns mirrors buildFieldCacheEntryForType in the dml package: exported fields with a `dml`
+// tag become columns, and untagged embedded structs (or pointers to them) are traversed into unless
+// they implement NoDefaults. Malformed tags on exported fields are reported as errors, as they are
+// at runtime; unexported fields are ignored. As at runtime, a struct which embeds a pointer to
+// itself is an error.
+func Columns(s *types.Struct) ([]Column, error) {
+	return columns(s, nil, false, nil)
+}
+
+// columns does the work of Columns. outer holds the structs enclosing s, from the outermost, so that
+// embedding cycles can be detected.
+func columns(s *types.Struct, path []string, indirect bool, outer []*types.Struct) (output []Column, err error) {
+	for i := 0; i < s.NumFields(); i++ {
+		field := s.Field(i)
+		field_path := append(path[:len(path):len(path)], field.Name())
+		if !field.Exported() && !field.Anonymous() { continue }
+		var tag dml.FieldTag
+		var ok bool
+		if field.Exported() {
+			var tag_err error
+			tag, ok, tag_err = dml.ParseTag(reflect.StructTag(s.Tag(i)))
+			if tag_err != nil { return nil, fmt.Errorf("error examining field %s: %w", field.Name(), tag_err) }
+		}
+		if ok {
+			output = append(output, Column{
+				Tag:     tag,
+				Path:    field_path,
+				Type:    field.Type(),
+				Scanner: types.Implements(field.Type(), scannerType),
+				Indirect: indirect,
+			})
+		} else if field.Anonymous() {
+			t, pointer := field.Type(), false
+			if p, ok := t.(*types.Pointer); ok { t, pointer = p.Elem(), true }
+			sub, ok := t.Underlying().(*types.Struct)
+			if !ok || HasMethod(t, "NoDefaults") { continue }
+			for _, o := range append(outer, s) {
+				if o == sub { return nil, fmt.Errorf("error examining field %s: %v embeds itself", field.Name(), t) }
+			}
+			sub_columns, sub_err := columns(sub, field_path, indirect || pointer, append(outer, s))
+			if sub_err != nil { return nil, fmt.Errorf("error examining field %s: %w", field.Name(), sub_err) }
+			output = append(output, sub_columns...)
+		}
+	}
+
+	return output, nil
+}
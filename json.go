@@ -0,0 +1,68 @@
+package dml
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// JSONMarshal and JSONUnmarshal are used to encode and decode fields tagged with the `json`
+// option. They default to the encoding/json functions, and can be replaced with any functions
+// which behave the same way, such as those of a faster JSON library.
+var (
+	JSONMarshal   = json.Marshal
+	JSONUnmarshal = json.Unmarshal
+)
+
+// JSONField wraps a pointer to a field whose column holds JSON. It is both a sql.Scanner, which
+// decodes the column into the field, and a driver.Valuer, which encodes the field for writing.
+type JSONField struct {
+	field interface{}
+}
+
+// JSON wraps field, which must be a pointer, so that its column is decoded from JSON when scanned.
+// NULL stores the zero value into the field. The result can also be passed to Exec, where it
+// encodes the field as JSON. This is what the `json` tag option does, and can be used in GetFields
+// implementations (and for query arguments) to the same effect.
+func JSON(field interface{}) *JSONField {
+	return &JSONField{field: field}
+}
+
+// JSONField.Scan decodes src, which must be NULL, a string or a []byte, into the field.
+func (j *JSONField) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		dv := reflect.ValueOf(j.field).Elem()
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		return fmt.Errorf("cannot decode JSON from %T", src)
+	}
+
+	// decode into a fresh value, so that fields which aren't in the JSON don't keep their old values.
+	dv := reflect.ValueOf(j.field).Elem()
+	fresh := reflect.New(dv.Type())
+	if err := JSONUnmarshal(data, fresh.Interface()); err != nil { return fmt.Errorf("decoding JSON into %v: %w", dv.Type(), err) }
+	dv.Set(fresh.Elem())
+	return nil
+}
+
+// JSONField.Value encodes the field as JSON. Nil pointers, maps, slices and interfaces are
+// written as NULL, mirroring the way NULL is scanned.
+func (j *JSONField) Value() (driver.Value, error) {
+	dv := reflect.ValueOf(j.field).Elem()
+	switch dv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if dv.IsNil() { return nil, nil }
+	}
+
+	data, err := JSONMarshal(dv.Interface())
+	if err != nil { return nil, fmt.Errorf("encoding %v as JSON: %w", dv.Type(), err) }
+	return data, nil
+}
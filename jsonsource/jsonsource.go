@@ -0,0 +1,199 @@
+// Package jsonsource reads JSON objects as rows, so that structs with `dml` tags can be populated
+// from fixtures and message payloads the same way they are from query results:
+//
+//     err := dml.ScanArray(jsonsource.New(r), &users)
+//
+// The input is either a sequence of objects, such as JSON Lines, or a single array of objects.
+// Each object is a row, whose columns are its keys, in order; rows don't need to have the same
+// keys, and ScanArray maps each row's columns afresh when they change. Values are stored into fields
+// as database/sql would store them (see dml.ConvertAssign): strings as strings, numbers as int64
+// when they are integers and float64 otherwise, booleans as bools and null as NULL. Nested objects
+// and arrays are left as their JSON text, as a []byte, for fields with the `json` tag option.
+// Strings stored in time.Time fields (or *time.Time) are parsed as RFC 3339, as encoding/json would.
+package jsonsource
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/thewug/dml/internal/assign"
+)
+
+// Source is a dml.VaryingColumnsScannable which reads rows from JSON objects.
+type Source struct {
+	reader  *bufio.Reader
+	dec     *json.Decoder
+	started bool
+	array   bool
+	done    bool
+	err     error
+
+	// the current row, and the next one, if it has been read ahead to find its columns.
+	current, pending *row
+	changed          bool
+	rows             int
+}
+
+// row is a single object, with its keys and values in order.
+type row struct {
+	names  []string
+	values []interface{}
+}
+
+// New returns a Source which reads from r. Whether r holds an array or a sequence of objects is
+// decided from its first character, once the columns or the first row are asked for.
+func New(r io.Reader) *Source {
+	return &Source{reader: bufio.NewReader(r)}
+}
+
+// Source.start finds out what kind of input it is reading, and consumes the opening bracket of an array.
+func (s *Source) start() error {
+	s.started = true
+	for {
+		c, err := s.reader.ReadByte()
+		if err == io.EOF {
+			s.done = true
+			return nil
+		}
+		if err != nil { return err }
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' { continue }
+		if err = s.reader.UnreadByte(); err != nil { return err }
+		s.dec = json.NewDecoder(s.reader)
+		if c != '[' { return nil }
+		s.array = true
+		_, err = s.dec.Token()
+		return err
+	}
+}
+
+// Source.read reads the next object, returning nil at the end of the input.
+func (s *Source) read() (*row, error) {
+	if !s.started {
+		if err := s.start(); err != nil { return nil, err }
+	}
+	if s.done || (s.array && !s.dec.More()) { return nil, s.finish() }
+
+	t, err := s.dec.Token()
+	if err == io.EOF { return nil, s.finish() }
+	if err != nil { return nil, err }
+	if t != json.Delim('{') { return nil, fmt.Errorf("jsonsource: row %d is not an object", s.rows + 1) }
+
+	// the names of an empty object aren't nil, since that would mean nothing is known about them.
+	r := &row{names: []string{}}
+	for s.dec.More() {
+		t, err := s.dec.Token()
+		if err != nil { return nil, err }
+		var raw json.RawMessage
+		if err = s.dec.Decode(&raw); err != nil { return nil, err }
+		value, err := convert(raw)
+		if err != nil { return nil, err }
+		r.names = append(r.names, t.(string))
+		r.values = append(r.values, value)
+	}
+	if _, err = s.dec.Token(); err != nil { return nil, err }
+	return r, nil
+}
+
+// Source.finish consumes the end of an array, and checks that nothing follows it.
+func (s *Source) finish() error {
+	if s.done { return nil }
+	s.done = true
+	if !s.array { return nil }
+	if _, err := s.dec.Token(); err != nil { return err }
+	if _, err := s.dec.Token(); err != io.EOF { return errors.New("jsonsource: unexpected data after the array") }
+	return nil
+}
+
+// convert turns a JSON value into the value a database driver would produce for it.
+func convert(raw json.RawMessage) (interface{}, error) {
+	switch raw[0] {
+	case 'n':
+		return nil, nil
+	case 't', 'f':
+		return raw[0] == 't', nil
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case '{', '[':
+		return append([]byte(nil), raw...), nil
+	}
+	if i, err := strconv.ParseInt(string(raw), 10, 64); err == nil { return i, nil }
+	return strconv.ParseFloat(string(raw), 64)
+}
+
+// Source.ColumnNames returns the keys of the current row or, before the first call to Next, of
+// the first row. If there are no rows, it returns nil, since nothing is known about the columns.
+func (s *Source) ColumnNames() ([]string, error) {
+	if s.current != nil { return s.current.names, nil }
+	if s.pending == nil && !s.done && s.err == nil {
+		s.pending, s.err = s.read()
+	}
+	if s.err != nil { return nil, s.err }
+	if s.pending == nil { return nil, nil }
+	return s.pending.names, nil
+}
+
+// Source.Next reads the next row, returning false at the end of the input or if there is an
+// error, which Err then returns.
+func (s *Source) Next() bool {
+	if s.err != nil { return false }
+	next := s.pending
+	s.pending = nil
+	if next == nil { next, s.err = s.read() }
+	if next == nil {
+		s.current = nil
+		return false
+	}
+
+	previous := s.current
+	s.changed = previous != nil && !equal(previous.names, next.names)
+	s.current = next
+	s.rows++
+	return true
+}
+
+// equal reports whether two lists of names are the same.
+func equal(a, b []string) bool {
+	if len(a) != len(b) { return false }
+	for i := range a {
+		if a[i] != b[i] { return false }
+	}
+	return true
+}
+
+// Source.ColumnsChanged reports whether the current row has different keys to the one before it.
+func (s *Source) ColumnsChanged() bool {
+	return s.changed
+}
+
+// Source.Err returns the error which ended the iteration, or nil if it reached the end of the input.
+func (s *Source) Err() error {
+	return s.err
+}
+
+// Source.Close ends the iteration. It doesn't close r, which belongs to the caller.
+func (s *Source) Close() error {
+	s.done, s.current, s.pending = true, nil, nil
+	return nil
+}
+
+// Source.Scan stores the values of the current row into dest, one per column.
+func (s *Source) Scan(dest ...interface{}) error {
+	if s.current == nil { return errors.New("jsonsource: Scan called without a row") }
+	if len(dest) != len(s.current.values) { return fmt.Errorf("jsonsource: expected %d destination arguments in Scan, not %d", len(s.current.values), len(dest)) }
+	for i, d := range dest {
+		if err := assign.Value(d, s.current.values[i], parseTime); err != nil { return fmt.Errorf("jsonsource: row %d, column %q: %w", s.rows, s.current.names[i], err) }
+	}
+	return nil
+}
+
+// parseTime parses a string stored in a time.Time field as RFC 3339, as encoding/json would.
+func parseTime(str string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, str)
+}
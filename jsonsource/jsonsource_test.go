@@ -0,0 +1,124 @@
+package jsonsource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewug/dml"
+)
+
+type settings struct {
+	Theme string `json:"theme"`
+}
+
+type event struct {
+	Id       int64      `dml:"id"`
+	Kind     string     `dml:"kind,default=info"`
+	Score    float64    `dml:"score"`
+	Ok       bool       `dml:"ok"`
+	At       time.Time  `dml:"at"`
+	Until    *time.Time `dml:"until"`
+	Settings settings   `dml:"settings,json"`
+	Tags     []string   `dml:"tags,json"`
+
+	processed bool
+}
+
+func (e *event) PostScan() error {
+	e.processed = true
+	return nil
+}
+
+type Stamp struct {
+	Created time.Time `dml:"created"`
+}
+
+type stamped struct {
+	*Stamp
+	Id int64 `dml:"id"`
+}
+
+func Test_ScanArray(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expected := []event{
+		{Id: 1, Kind: "warn", Score: 1.5, Ok: true, At: at, Settings: settings{"dark"}, Tags: []string{"a", "b"}},
+		{Id: 2, Kind: "info", Score: 3, At: at},
+		{Id: 3, Kind: "info"},
+	}
+
+	testcases := map[string]string{
+		"lines": `{"id": 1, "kind": "warn", "score": 1.5, "ok": true, "at": "2024-01-02T03:04:05Z", "until": null, "settings": {"theme": "dark"}, "tags": ["a", "b"]}
+{"at": "2024-01-02T03:04:05Z", "score": 3, "id": 2, "extra": "ignored"}
+{"id": 3}
+`,
+		"array": `  [
+	{"id": 1, "kind": "warn", "score": 1.5, "ok": true, "at": "2024-01-02T03:04:05Z", "until": null, "settings": {"theme": "dark"}, "tags": ["a", "b"]},
+	{"at": "2024-01-02T03:04:05Z", "score": 3, "id": 2, "extra": "ignored"},
+	{"id": 3}
+]
+`,
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			src := New(strings.NewReader(v))
+			var out []event
+			if err := dml.ScanArray(src, &out); err != nil || src.Err() != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, %v", err, src.Err()) }
+			if !reflect.DeepEqual(out, expected) { t.Errorf("Unexpected result (ScanArray): got %+v, expected %+v", out, expected) }
+		})
+	}
+}
+
+func Test_Scan(t *testing.T) {
+	src := New(strings.NewReader(`{"id": 1, "until": "2024-01-02T00:00:00Z"}{"id": 2}`))
+	names, err := src.ColumnNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"id", "until"}) { t.Errorf("Unexpected return value (ColumnNames): got %v, %v", names, err) }
+
+	var e event
+	if !src.Next() || src.ColumnsChanged() { t.Fatalf("Expected a first row with the same columns") }
+	if err := dml.Scan(src, &e); err != nil || e.Id != 1 || e.Until == nil || !e.processed { t.Errorf("Unexpected result (Scan): got %+v, %v", e, err) }
+	if !src.Next() || !src.ColumnsChanged() { t.Fatalf("Expected a second row with different columns") }
+	if err := dml.Scan(src, &e); err != nil || e.Id != 2 { t.Errorf("Unexpected result (Scan): got %+v, %v", e, err) }
+	if src.Next() || src.Err() != nil { t.Errorf("Expected the end of the input, got %v", src.Err()) }
+
+	// an empty object is a row without columns, whose fields receive their defaults.
+	src = New(strings.NewReader(`{"id": 1, "kind": "warn"}` + "\n{}\n"))
+	var events []event
+	if err := dml.ScanArray(src, &events); err != nil || src.Err() != nil { t.Fatalf("Unexpected return value (ScanArray): got %v, %v", err, src.Err()) }
+	if !reflect.DeepEqual(events, []event{{Id: 1, Kind: "warn"}, {Kind: "info"}}) { t.Errorf("Unexpected result (ScanArray): got %+v", events) }
+
+	// times behind nil embedded pointers are parsed too.
+	src = New(strings.NewReader(`{"id": 1, "created": "2024-01-02T03:04:05Z"}`))
+	var stamps []stamped
+	if err := dml.ScanArray(src, &stamps); err != nil || len(stamps) != 1 || stamps[0].Stamp == nil || !stamps[0].Created.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) { t.Errorf("Unexpected result (ScanArray): got %+v, %v", stamps, err) }
+
+	src = New(strings.NewReader(" \n"))
+	var out []event
+	if names, err := src.ColumnNames(); names != nil || err != nil { t.Errorf("Unexpected return value (ColumnNames): got %v, %v", names, err) }
+	if err := dml.ScanArray(src, &out); err != nil || len(out) != 0 { t.Errorf("Unexpected result (ScanArray): got %+v, %v", out, err) }
+}
+
+func Test_Errors(t *testing.T) {
+	testcases := map[string]struct{
+		data string
+		err string
+	}{
+		"not object": {`[1]`, "row 1 is not an object"},
+		"syntax":     {`{"id": 1}{"id": }`, "invalid character"},
+		"trailing":   {`[{"id": 1}] {}`, "unexpected data after the array"},
+		"type":       {`{"id": "x"}`, `row 1, column "id": converting`},
+		"time":       {`{"at": "yesterday"}`, `row 1, column "at": parsing time`},
+	}
+
+	for k, v := range testcases {
+		t.Run(k, func(t *testing.T) {
+			src := New(strings.NewReader(v.data))
+			var out []event
+			err := dml.ScanArray(src, &out)
+			if err == nil { err = src.Err() }
+			if err == nil || !strings.Contains(err.Error(), v.err) { t.Errorf("Unexpected error: got %v, expected %q", err, v.err) }
+		})
+	}
+}
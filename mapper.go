@@ -0,0 +1,102 @@
+package dml
+
+import (
+	"strings"
+	"sync"
+)
+
+// Mapper holds everything which decides how struct fields are matched with columns: the struct tags
+// which name them, how names are compared, which converters apply, and whether column types are
+// validated, along with its own cache of the types it has examined. The package-level functions
+// use DefaultMapper, so code which needs different behaviour can use a Mapper of its own without
+// affecting anything else.
+//
+// A Mapper's configuration must not be changed once it has been used, since the types it has
+// already examined won't be examined again. Mappers must not be copied, and must be made with
+// NewMapper.
+type Mapper struct {
+	// TagKeys are the struct tag keys which fields are tagged with, in order of precedence. A field
+	// is populated from the column named by the first of them which it has and which names one,
+	// according to TagParser, so {"dml", "db"} reads `dml` tags, or `db` tags for fields without.
+	TagKeys []string
+
+	// TagParser interprets tags. If it is nil, DefaultTagParser is used.
+	TagParser TagParser
+
+	// Normalize, if it is set, is applied to the names of columns and to each alias of the names of
+	// fields before they are compared, so strings.ToLower makes matching case insensitive.
+	Normalize func(string) string
+
+	// Converters is consulted by Scan, ScanWithFields and ScanArray. It may be nil. DefaultMapper's
+	// is DefaultConverters, which RegisterConverter adds to.
+	Converters *Converters
+
+	// ValidateTypes makes Scan, ScanWithFields and ScanArray check the types of the columns they are
+	// given against the types of the fields those columns map to, using ValidateMap, before scanning
+	// anything. It is off by default, since drivers vary in how much they report about their columns,
+	// and since the check costs a little for every result set. Setting DefaultMapper's turns it on
+	// for the package-level functions.
+	ValidateTypes bool
+
+	// cache maps each reflect.Type the Mapper has examined to a *fieldsCacheSlot.
+	cache sync.Map
+}
+
+// NewMapper returns a Mapper which reads `dml` tags, matches names exactly, has its own empty set
+// of converters, and doesn't validate types; in other words, one which behaves like DefaultMapper
+// before anything has been registered with it.
+func NewMapper() *Mapper {
+	return &Mapper{TagKeys: []string{"dml"}, Converters: NewConverters()}
+}
+
+// DefaultMapper is the Mapper used by the package-level functions. It uses DefaultConverters, so
+// that converters added with RegisterConverter apply to them.
+var DefaultMapper = &Mapper{TagKeys: []string{"dml"}, Converters: DefaultConverters}
+
+// Mapper.normalizeFields returns the names of fields with m.Normalize applied to each alias, or
+// the names themselves if m doesn't normalize names.
+func (m *Mapper) normalizeFields(fields NamedFields) []string {
+	if m.Normalize == nil { return fields.Names }
+	output := make([]string, len(fields.Names))
+	for i, n := range fields.Names {
+		var b strings.Builder
+		for alias, rest, more := splitAlias(n); ; alias, rest, more = splitAlias(rest) {
+			b.WriteString(m.Normalize(alias))
+			if !more { break }
+			b.WriteByte('|')
+		}
+		output[i] = b.String()
+	}
+	return output
+}
+
+// Mapper.QuickScan is QuickScan, using m to find the fields of into.
+func (m *Mapper) QuickScan(s Scannable, into ...ScanInto) error {
+	fields, err := m.BuildNamedFields(into)
+	if err != nil { return err }
+	if err = ScanWithMappedFields(s, nil, fields); err != nil { return err }
+	return postScan(into)
+}
+
+// Mapper.Scan is Scan, using m to find the fields of into and map columns to them.
+func (m *Mapper) Scan(adv AdvancedScannable, into ...ScanInto) error {
+	fields, err := m.BuildNamedFields(into)
+	if err != nil { return err }
+	if err = m.ScanWithFields(adv, fields); err != nil { return err }
+	return postScan(into)
+}
+
+// Mapper.ScanWithFields is ScanWithFields, using m to map columns to fields.
+func (m *Mapper) ScanWithFields(adv AdvancedScannable, fields NamedFields) error {
+	smap, conv, err := m.buildMap(adv, fields)
+	if err != nil { return err }
+	return scanMapped(adv, smap, conv, fields)
+}
+
+// Mapper.ScanWithMap is ScanWithMap, using m to find the fields of into.
+func (m *Mapper) ScanWithMap(s Scannable, smap ScanMap, into ...ScanInto) error {
+	fields, err := m.BuildNamedFields(into)
+	if err != nil { return err }
+	if err = ScanWithMappedFields(s, smap, fields); err != nil { return err }
+	return postScan(into)
+}
@@ -0,0 +1,319 @@
+package dml
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ArrayField wraps a pointer to a slice whose column holds a Postgres array. It is both a
+// sql.Scanner, which parses the array's text representation into the slice, and a driver.Valuer,
+// which formats the slice as an array literal for writing.
+type ArrayField struct {
+	field interface{}
+}
+
+// Array wraps field, which must be a pointer to a slice, so that its column is parsed as a Postgres
+// array literal (such as `{1,2,NULL}` or `{"a b","c\"d"}`) when scanned. NULL stores a nil slice.
+// Elements are stored as database/sql would store a column holding their text (see ConvertAssign),
+// NULL elements need an element type which can hold them, and nested arrays need nested slices.
+// The result can also be passed to Exec, where it formats the slice as an array literal. This is
+// what the `array` tag option does, and can be used in GetFields implementations to the same effect.
+func Array(field interface{}) *ArrayField {
+	return &ArrayField{field: field}
+}
+
+// ArrayField.Scan parses src, which must be NULL, a string or a []byte, into the slice.
+func (a *ArrayField) Scan(src interface{}) error {
+	return scanArrayInto(a.field, src)
+}
+
+// ArrayField.Value formats the slice as an array literal. A nil slice is written as NULL.
+func (a *ArrayField) Value() (driver.Value, error) {
+	dv := reflect.ValueOf(a.field).Elem()
+	if dv.IsNil() { return nil, nil }
+	buf, err := appendArray(nil, dv)
+	if err != nil { return nil, err }
+	return string(buf), nil
+}
+
+// scanArrayInto parses src into dst, a pointer to a slice.
+func scanArrayInto(dst, src interface{}) error {
+	dv := reflect.ValueOf(dst).Elem()
+	var text string
+	switch s := src.(type) {
+	case nil:
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	case []byte:
+		text = string(s)
+	case string:
+		text = s
+	default:
+		return fmt.Errorf("cannot parse array from %T", src)
+	}
+
+	elems, err := parseArray(text)
+	if err != nil { return err }
+	return assignArray(dv, elems)
+}
+
+// arrayElem is a single element of a parsed array literal: a value, NULL, or a nested array.
+type arrayElem struct {
+	value  string
+	null   bool
+	nested []arrayElem
+	array  bool
+}
+
+// literalParser holds the state of a parse of a Postgres text literal.
+type literalParser struct {
+	s   string
+	pos int
+}
+
+func (p *literalParser) skipSpace() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n\r\v\f", p.s[p.pos]) >= 0 { p.pos++ }
+}
+
+func (p *literalParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("malformed literal %q at offset %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+// literalParser.quoted reads a double quoted string, in which backslash escapes the next character.
+// Postgres composites also allow a doubled double quote, which is handled when doubled is set.
+func (p *literalParser) quoted(doubled bool) (string, error) {
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && p.pos + 1 < len(p.s):
+			b.WriteByte(p.s[p.pos + 1])
+			p.pos += 2
+		case c == '"' && doubled && p.pos + 1 < len(p.s) && p.s[p.pos + 1] == '"':
+			b.WriteByte('"')
+			p.pos += 2
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated quoted string")
+}
+
+// literalParser.unquoted reads characters up to (but not including) one of the terminators,
+// honouring backslash escapes.
+func (p *literalParser) unquoted(terminators string) string {
+	var b strings.Builder
+	for p.pos < len(p.s) && strings.IndexByte(terminators, p.s[p.pos]) < 0 {
+		if p.s[p.pos] == '\\' && p.pos + 1 < len(p.s) { p.pos++ }
+		b.WriteByte(p.s[p.pos])
+		p.pos++
+	}
+	return b.String()
+}
+
+// parseArray parses a Postgres array literal, optionally preceded by dimension decorations.
+func parseArray(s string) ([]arrayElem, error) {
+	p := &literalParser{s: s}
+	p.skipSpace()
+	if p.pos < len(s) && s[p.pos] == '[' {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 { return nil, p.errorf("dimensions without '='") }
+		p.pos = eq + 1
+		p.skipSpace()
+	}
+
+	elems, err := p.array()
+	if err != nil { return nil, err }
+	p.skipSpace()
+	if p.pos != len(s) { return nil, p.errorf("unexpected trailing characters") }
+	return elems, nil
+}
+
+// literalParser.array parses a brace delimited array, positioned on its opening brace.
+func (p *literalParser) array() (output []arrayElem, err error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' { return nil, p.errorf("expected '{'") }
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		return []arrayElem{}, nil
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) { return nil, p.errorf("unterminated array") }
+
+		var elem arrayElem
+		switch p.s[p.pos] {
+		case '{':
+			elem.array = true
+			if elem.nested, err = p.array(); err != nil { return nil, err }
+		case '"':
+			if elem.value, err = p.quoted(false); err != nil { return nil, err }
+		default:
+			elem.value = strings.TrimRight(p.unquoted(",}"), " \t\n\r\v\f")
+			if elem.value == "" { return nil, p.errorf("empty unquoted element") }
+			elem.null = strings.EqualFold(elem.value, "NULL")
+		}
+		output = append(output, elem)
+
+		p.skipSpace()
+		if p.pos >= len(p.s) { return nil, p.errorf("unterminated array") }
+		switch p.s[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return output, nil
+		default:
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+// assignArray stores elems into dv, which must be a slice.
+func assignArray(dv reflect.Value, elems []arrayElem) error {
+	if dv.Kind() != reflect.Slice { return fmt.Errorf("cannot store an array in %v", dv.Type()) }
+	out := reflect.MakeSlice(dv.Type(), len(elems), len(elems))
+	for i, e := range elems {
+		if err := assignElement(out.Index(i), e); err != nil { return fmt.Errorf("array element %d: %w", i, err) }
+	}
+	dv.Set(out)
+	return nil
+}
+
+// assignElement stores a single array element into ev.
+func assignElement(ev reflect.Value, e arrayElem) error {
+	if e.array {
+		if ev.Kind() != reflect.Slice || ev.Type().Elem().Kind() == reflect.Uint8 { return fmt.Errorf("cannot store a nested array in %v", ev.Type()) }
+		return assignArray(ev, e.nested)
+	}
+	if !e.null { return ConvertAssign(ev.Addr().Interface(), e.value) }
+
+	switch ev.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		ev.Set(reflect.Zero(ev.Type()))
+		return nil
+	}
+	if scanner, ok := ev.Addr().Interface().(sql.Scanner); ok { return scanner.Scan(nil) }
+	return fmt.Errorf("NULL cannot be stored in %v", ev.Type())
+}
+
+// appendArray formats v, a slice, as a Postgres array literal.
+func appendArray(buf []byte, v reflect.Value) ([]byte, error) {
+	buf = append(buf, '{')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 { buf = append(buf, ',') }
+		text, null, nested, err := elementText(v.Index(i))
+		if err != nil { return nil, fmt.Errorf("array element %d: %w", i, err) }
+		switch {
+		case null:
+			buf = append(buf, "NULL"...)
+		case nested.IsValid():
+			if buf, err = appendArray(buf, nested); err != nil { return nil, err }
+		default:
+			buf = appendQuoted(buf, text, `{}",\`)
+		}
+	}
+	return append(buf, '}'), nil
+}
+
+// elementText renders a value as the text of a literal element. It reports whether the value is
+// NULL, and returns nested slices separately, for the caller to format as it needs to.
+func elementText(ev reflect.Value) (text string, null bool, nested reflect.Value, err error) {
+	if ev.CanInterface() {
+		if valuer, ok := ev.Interface().(driver.Valuer); ok {
+			if ev.Kind() == reflect.Ptr && ev.IsNil() { return "", true, reflect.Value{}, nil }
+			value, err := valuer.Value()
+			if err != nil { return "", false, reflect.Value{}, err }
+			if value == nil { return "", true, reflect.Value{}, nil }
+			ev = reflect.ValueOf(value)
+		}
+	}
+	for ev.Kind() == reflect.Ptr || ev.Kind() == reflect.Interface {
+		if ev.IsNil() { return "", true, reflect.Value{}, nil }
+		ev = ev.Elem()
+	}
+
+	switch ev.Kind() {
+	case reflect.Slice:
+		if ev.Type().Elem().Kind() == reflect.Uint8 { return string(ev.Bytes()), false, reflect.Value{}, nil }
+		if ev.IsNil() { return "", true, reflect.Value{}, nil }
+		return "", false, ev, nil
+	case reflect.Struct:
+		if t, ok := ev.Interface().(time.Time); ok { return t.Format(time.RFC3339Nano), false, reflect.Value{}, nil }
+		return "", false, reflect.Value{}, fmt.Errorf("cannot format %v as an element", ev.Type())
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return asString(ev.Interface()), false, reflect.Value{}, nil
+	}
+	return "", false, reflect.Value{}, fmt.Errorf("cannot format %v as an element", ev.Type())
+}
+
+// appendQuoted appends text to buf, double quoting it if it is empty, is NULL, or contains
+// whitespace or any of the special characters.
+func appendQuoted(buf []byte, text string, special string) []byte {
+	if text != "" && !strings.EqualFold(text, "NULL") && !strings.ContainsAny(text, special + " \t\n\r\v\f") {
+		return append(buf, text...)
+	}
+
+	buf = append(buf, '"')
+	for i := 0; i < len(text); i++ {
+		if text[i] == '"' || text[i] == '\\' { buf = append(buf, '\\') }
+		buf = append(buf, text[i])
+	}
+	return append(buf, '"')
+}
+
+// isArrayTypeName reports whether a database type name denotes a Postgres array, as reported by
+// lib/pq and pgx ("_INT8") or written in SQL ("int8[]").
+func isArrayTypeName(name string) bool {
+	return len(name) > 1 && (name[0] == '_' || strings.HasSuffix(name, "[]"))
+}
+
+// arrayConverter parses array literals into any slice.
+var arrayConverter = &converter{
+	accepts: func(interface{}) bool { return true },
+	assign:  scanArrayInto,
+}
+
+// isArrayField reports whether field is a pointer to a slice which could receive an array: not
+// []byte, and not a sql.Scanner of its own.
+func isArrayField(field interface{}) bool {
+	ft := reflect.TypeOf(field)
+	if ft == nil || ft.Kind() != reflect.Ptr || ft.Implements(sqlScannerType) { return false }
+	return ft.Elem().Kind() == reflect.Slice && ft.Elem().Elem().Kind() != reflect.Uint8
+}
+
+// detectArrays adds a conversion to conv for each column which the column metadata of adv says
+// is an array, and which is mapped to a slice field without a conversion already.
+func detectArrays(adv AdvancedScannable, m ScanMap, fields NamedFields, conv conversions) (conversions, error) {
+	cis, ok := adv.(ColumnInfoScannable)
+	if !ok || m == nil { return conv, nil }
+
+	var columns []ColumnInfo
+	for i, idx := range m {
+		if idx < 0 || (conv != nil && conv[i] != nil) || !isArrayField(fields.Fields[idx]) { continue }
+		if columns == nil {
+			var err error
+			if columns, err = cis.Columns(); err != nil { return nil, err }
+			if columns == nil { return conv, nil }
+		}
+		if i >= len(columns) || !isArrayTypeName(columns[i].DatabaseTypeName) { continue }
+
+		if conv == nil { conv = make(conversions, len(m)) }
+		conv[i] = &boundConverter{converter: arrayConverter}
+	}
+
+	return conv, nil
+}
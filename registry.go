@@ -0,0 +1,161 @@
+package dml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ColumnDescription describes one of the columns a struct type is populated from, as reported by Describe.
+type ColumnDescription struct {
+	Name  string       // the column name, as it appears in NamedFields (so possibly a list of aliases)
+	Tag   FieldTag     // the parsed tag of the field, for columns found from tags
+	Path  []string     // the names of the fields leading to this one, starting from the outer struct
+	Index []int        // the index sequence of the field, as used by reflect's FieldByIndex
+	Type  reflect.Type // the type of the field, or for GetFields columns which aren't one of its fields, of what is scanned into
+
+	// FromGetFields is set for columns contributed by a GetFields method. Path and Index are nil
+	// if the value it returned isn't (a wrapper around) the address of one of the struct's fields.
+	FromGetFields bool
+}
+
+// structType finds the struct type described by v, which may be a reflect.Type, or a value of
+// (or pointer to) the type.
+func structType(v interface{}) (reflect.Type, error) {
+	t, ok := v.(reflect.Type)
+	if !ok { t = reflect.TypeOf(v) }
+	if t == nil { return nil, errors.New("nil value is not acceptable") }
+	for t.Kind() == reflect.Ptr { t = t.Elem() }
+	if t.Kind() != reflect.Struct { return nil, fmt.Errorf("%v is not a struct", t) }
+	return t, nil
+}
+
+// RegisterError is returned by Register, and lists the error of every type which failed.
+type RegisterError []error
+
+func (e RegisterError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e { messages[i] = err.Error() }
+	return strings.Join(messages, "; ")
+}
+
+// Register builds and caches the field information for each of the given types, which may be
+// given as values, pointers, or reflect.Types, so that mistakes in their tags are found at startup
+// instead of on their first scan. Every type is registered even if some fail, and the errors of
+// those which did are returned together, as a RegisterError.
+func Register(types ...interface{}) error {
+	return DefaultMapper.Register(types...)
+}
+
+// Mapper.Register is Register, for m.
+func (m *Mapper) Register(types ...interface{}) error {
+	var errs RegisterError
+	for _, v := range types {
+		t, err := structType(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("registering %T: %w", v, err))
+			continue
+		}
+		if _, err = m.getFieldCachesFor(t); err != nil { errs = append(errs, fmt.Errorf("registering %v: %w", t, err)) }
+	}
+	if len(errs) != 0 { return errs }
+	return nil
+}
+
+// Describe lists the columns the struct type described by v (see Register) is populated from, in
+// the order dml scans them, along with the fields they land in. For types which implement
+// GetFields, it is called on a new zero value to find the columns it contributes.
+func Describe(v interface{}) ([]ColumnDescription, error) {
+	return DefaultMapper.Describe(v)
+}
+
+// Mapper.Describe is Describe, for the columns m finds.
+func (m *Mapper) Describe(v interface{}) ([]ColumnDescription, error) {
+	t, err := structType(v)
+	if err != nil { return nil, err }
+	entry, err := m.getFieldCachesFor(t)
+	if err != nil { return nil, err }
+	c := entry.(fieldCacheEntry)
+
+	var output []ColumnDescription
+	for i, name := range c.Names {
+		d := ColumnDescription{Name: name, Index: c.Fields[i]}
+		for j := range d.Index {
+			f := t.FieldByIndex(d.Index[:j + 1])
+			d.Path = append(d.Path, f.Name)
+			d.Type = f.Type
+			if j == len(d.Index) - 1 { d.Tag, _, _ = m.parseTag(f.Tag) }
+		}
+		output = append(output, d)
+	}
+
+	pv := reflect.New(t)
+	g, ok := pv.Interface().(GetFields)
+	if !ok { return output, nil }
+	fields, err := g.GetFields()
+	if err != nil { return nil, err }
+	for i, name := range fields.Names {
+		d := ColumnDescription{Name: name, FromGetFields: true}
+		target := unwrapField(fields.Fields[i])
+		if tt := reflect.TypeOf(target); tt != nil {
+			d.Type = tt
+			if tt.Kind() == reflect.Ptr { d.Type = tt.Elem() }
+		}
+		d.Index, d.Path = locateField(pv.Elem(), target)
+		output = append(output, d)
+	}
+	return output, nil
+}
+
+// unwrapField returns the pointer inside one of dml's field wrappers, or field itself.
+func unwrapField(field interface{}) interface{} {
+	switch w := field.(type) {
+	case *defaultScanner:
+		return w.field
+	case *JSONField:
+		return w.field
+	case *ArrayField:
+		return w.field
+	case *HstoreField:
+		return w.field
+	case *CompositeField:
+		return w.field
+	}
+	return field
+}
+
+// locateField finds the field of v, a struct, which target points to, searching embedded structs
+// too, and returns its index sequence and the names along it, or nil if it isn't found. Embedded
+// pointers are followed if they aren't nil (for instance, because GetFields allocated them).
+func locateField(v reflect.Value, target interface{}) ([]int, []string) {
+	tv := reflect.ValueOf(target)
+	if tv.Kind() != reflect.Ptr || tv.IsNil() { return nil, nil }
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		sf := v.Type().Field(i)
+		if f.Addr().Pointer() == tv.Pointer() && f.Addr().Type() == tv.Type() { return []int{i}, []string{sf.Name} }
+		if sf.Anonymous && f.Kind() == reflect.Ptr && !f.IsNil() { f = f.Elem() }
+		if sf.Anonymous && f.Kind() == reflect.Struct {
+			if index, path := locateField(f, target); index != nil {
+				return append([]int{i}, index...), append([]string{sf.Name}, path...)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ResetCache forgets the field information (and errors) of every type, so that it is built again
+// the next time it is needed. It is meant for tests.
+func ResetCache() {
+	DefaultMapper.ResetCache()
+}
+
+// Mapper.ResetCache is ResetCache, for m.
+func (m *Mapper) ResetCache() {
+	m.cache.Range(func(k, _ interface{}) bool {
+		m.cache.Delete(k)
+		return true
+	})
+}
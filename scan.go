@@ -12,10 +12,7 @@ import (
 // is empty, an error will be returned. Likewise, an error will be returned if
 // there is an underlying error while performing the scan.
 func QuickScan(s Scannable, into ...ScanInto) error {
-	fields, err := BuildNamedFields(into)
-	if err != nil { return err }
-	if err = ScanWithMappedFields(s, nil, fields); err != nil { return err }
-	return postScan(into)
+	return DefaultMapper.QuickScan(s, into...)
 }
 
 // Scan does the full gamut of pre-processing and field matching.  It is designed
@@ -25,26 +22,19 @@ func QuickScan(s Scannable, into ...ScanInto) error {
 // details about this process, see BuildMap. A ScanMap is automatically built to
 // map columns in `adv` to fields in `into`, and a NamedFields is automatically
 // built from `into`. Errors during the underlying scan are propagated to the caller.
+// Like the other package-level functions, Scan uses DefaultMapper; see Mapper.
 func Scan(adv AdvancedScannable, into ...ScanInto) error {
-	fields, err := BuildNamedFields(into)
-	if err != nil { return err }
-	if err = ScanWithFields(adv, fields); err != nil { return err }
-	return postScan(into)
+	return DefaultMapper.Scan(adv, into...)
 }
 
 // ScanWithFields takes a pre-existing NamedFields. Otherwise it works the same way as Scan.
 func ScanWithFields(adv AdvancedScannable, fields NamedFields) error {
-	m, err := BuildMap(adv, fields)
-	if err != nil { return err }
-	return ScanWithMappedFields(adv, m, fields)
+	return DefaultMapper.ScanWithFields(adv, fields)
 }
 
 // ScanWithMap takes a pre-existing ScanMap. Otherwise it works the same way as Scan.
 func ScanWithMap(s Scannable, m ScanMap, into ...ScanInto) error {
-	fields, err := BuildNamedFields(into)
-	if err != nil { return err }
-	if err = ScanWithMappedFields(s, m, fields); err != nil { return err }
-	return postScan(into)
+	return DefaultMapper.ScanWithMap(s, m, into...)
 }
 
 // ScanWithMappedFields is the implementation upon which all others eventually land.
@@ -54,15 +44,28 @@ func ScanWithMap(s Scannable, m ScanMap, into ...ScanInto) error {
 // This function makes no attempt to check that the type of the field a column maps to
 // is appropriate to receive values from that column, only that the names match; values
 // with incompatible types being passed to Scannable.Scan will result in errors which will
-// propagate up to the caller.
+// propagate up to the caller. To check types before scanning, see ValidateMap.
+// Fields wrapped by Default which no column maps to receive their default values. Converters are
+// only applied by the functions which build the ScanMap themselves, since they are chosen then.
 func ScanWithMappedFields(s Scannable, m ScanMap, fields NamedFields) error {
+	return scanMapped(s, m, nil, fields)
+}
+
+// scanMapped is ScanWithMappedFields, plus the converters chosen for the columns when the map was built.
+func scanMapped(s Scannable, m ScanMap, conv conversions, fields NamedFields) error {
 	if len(fields.Fields) == 0 { return errors.New("cannot scan into empty list of fields") }
+	// a row of a varying source with no columns at all (such as an empty JSON object) has nothing to
+	// scan, but its fields can still receive their defaults. other sources can't have such rows.
+	if _, varying := s.(VaryingColumnsScannable); varying && m != nil && len(m) == 0 { return applyMissingDefaults(m, fields) }
 	field_list := fields.Fields
 	if m != nil {
 		field_list = make([]interface{}, 0, len(m))
-		for _, idx_into := range m {
+		for i, idx_into := range m {
 			if idx_into == -1 {
 				field_list = append(field_list, noopScanner{})
+			} else if conv != nil && conv[i] != nil {
+				conv[i].dst = fields.Fields[idx_into]
+				field_list = append(field_list, conv[i])
 			} else {
 				field_list = append(field_list, fields.Fields[idx_into])
 			}
@@ -70,5 +73,9 @@ func ScanWithMappedFields(s Scannable, m ScanMap, fields NamedFields) error {
 	}
 	// this seemingly identical error condition is deliberately included twice.
 	if len(field_list) == 0 { return errors.New("cannot scan into empty list of fields") }
-	return s.Scan(field_list...)
+	if err := s.Scan(field_list...); err != nil { return err }
+
+	// fields with defaults whose columns are missing receive their defaults.
+	if m != nil { return applyMissingDefaults(m, fields) }
+	return nil
 }
@@ -2,6 +2,7 @@ package dml
 
 import (
 	"database/sql"
+	"reflect"
 )
 
 // Scannable is designed to represent a database row yielding object, such as *sql.Row or *sql.Rows.
@@ -21,25 +22,136 @@ type sqlRows interface {
 }
 
 // sql.Rows.ColumnTypes() is stupid and unmockable, so fuck it. Stupid shim.
+// the column information is fetched once per result set and cached, since it can't change.
 type dumbAssFuckinAdapter struct {
 	sqlRows
+	cache *columnCache
+}
+
+// columnCache holds the column information for a dumbAssFuckinAdapter.
+type columnCache struct {
+	columns []ColumnInfo
+	names   []string
+}
+
+// current forgets the cached column information if it no longer describes the underlying rows,
+// which the caller may have closed, or moved to another result set, directly. *sql.Rows reports its
+// column names cheaply, so they are compared with the cached ones; an error means the rows are closed.
+func (piss dumbAssFuckinAdapter) current() error {
+	if piss.cache == nil || piss.cache.names == nil { return nil }
+	lister, ok := piss.sqlRows.(interface{ Columns() ([]string, error) })
+	if !ok { return nil }
+	names, err := lister.Columns()
+	if err != nil || !sameNames(names, piss.cache.names) { *piss.cache = columnCache{} }
+	return err
+}
+
+// sameNames reports whether a and b hold the same column names, in the same order.
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) { return false }
+	for i := range a {
+		if a[i] != b[i] { return false }
+	}
+	return true
+}
+
+// Shim Columns() from ColumnTypes().
+func (piss dumbAssFuckinAdapter) Columns() ([]ColumnInfo, error) {
+	if err := piss.current(); err != nil { return nil, err }
+	if piss.cache != nil && piss.cache.columns != nil { return piss.cache.columns, nil }
+	types, err := piss.sqlRows.ColumnTypes()
+	if err != nil { return nil, err }
+	columns := ColumnInfoFromTypes(types)
+	if piss.cache != nil {
+		piss.cache.columns = columns
+		piss.cache.names = namesOf(columns)
+	}
+	return columns, nil
 }
 
 // Shim ColumnNames() from ColumnTypes().
 func (piss dumbAssFuckinAdapter) ColumnNames() ([]string, error) {
-	columns, err := piss.sqlRows.ColumnTypes()
+	if err := piss.current(); err != nil { return nil, err }
+	if piss.cache != nil && piss.cache.names != nil { return piss.cache.names, nil }
+	columns, err := piss.Columns()
 	if err != nil { return nil, err }
-	names := []string{}
-	for _, c := range columns {
-		names = append(names, c.Name())
-	}
-	return names, nil
+	return namesOf(columns), nil
+}
+
+// Close closes the underlying rows, and forgets the cached column information.
+func (piss dumbAssFuckinAdapter) Close() error {
+	if piss.cache != nil { *piss.cache = columnCache{} }
+	return piss.sqlRows.Close()
+}
+
+// NextResultSet moves the underlying rows to their next result set, if they have one, and forgets
+// the cached column information, which belongs to the previous one.
+func (piss dumbAssFuckinAdapter) NextResultSet() bool {
+	if piss.cache != nil { *piss.cache = columnCache{} }
+	next, ok := piss.sqlRows.(interface{ NextResultSet() bool })
+	return ok && next.NextResultSet()
 }
 
 // Wrap an sql.Rows (or similar) in an adapter which converts ColumnTypes() to ColumnNames().
 // usage: rows, err := X(tx.Query(...))
 func X(rows sqlRows, err error) (IterableScannable, error) {
-	return dumbAssFuckinAdapter{sqlRows: rows}, err
+	return dumbAssFuckinAdapter{sqlRows: rows, cache: &columnCache{}}, err
+}
+
+// ColumnInfo describes a single column of a result set. Apart from the name, any of it may be
+// unknown, depending on what the driver reports: ScanType is then nil, DatabaseTypeName empty,
+// and the Has/Known flag for the other properties false.
+type ColumnInfo struct {
+	Name             string
+	DatabaseTypeName string
+	ScanType         reflect.Type
+
+	Nullable, NullableKnown bool
+
+	Length    int64
+	HasLength bool
+
+	Precision, Scale  int64
+	HasPrecisionScale bool
+}
+
+// emptyInterfaceType is the scan type database/sql reports when the driver doesn't report one.
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// ColumnInfoFromTypes converts the column types reported by *sql.Rows into ColumnInfo. database/sql
+// reports a scan type of interface{} for drivers which don't know it, which is recorded as unknown.
+func ColumnInfoFromTypes(types []*sql.ColumnType) []ColumnInfo {
+	output := make([]ColumnInfo, len(types))
+	for i, t := range types {
+		c := &output[i]
+		c.Name = t.Name()
+		c.DatabaseTypeName = t.DatabaseTypeName()
+		c.ScanType = t.ScanType()
+		if c.ScanType == emptyInterfaceType { c.ScanType = nil }
+		c.Nullable, c.NullableKnown = t.Nullable()
+		c.Length, c.HasLength = t.Length()
+		c.Precision, c.Scale, c.HasPrecisionScale = t.DecimalSize()
+	}
+	return output
+}
+
+// namesOf extracts the names from a list of ColumnInfo.
+func namesOf(columns []ColumnInfo) []string {
+	names := make([]string, len(columns))
+	for i := range columns { names[i] = columns[i].Name }
+	return names
+}
+
+// ColumnsOf returns the column information for adv. If adv is a ColumnInfoScannable, that comes
+// from Columns; otherwise only the names are known, and the rest is left empty. As with
+// ColumnNames, nil with no error means that nothing is known about the columns at all.
+func ColumnsOf(adv AdvancedScannable) ([]ColumnInfo, error) {
+	if cis, ok := adv.(ColumnInfoScannable); ok { return cis.Columns() }
+	names, err := adv.ColumnNames()
+	if err != nil || names == nil { return nil, err }
+	columns := make([]ColumnInfo, len(names))
+	for i := range names { columns[i].Name = names[i] }
+	return columns, nil
 }
 
 // AdvancedScannable is Scannable, plus a ColumnTypes function (as provided by *sql.Rows) which allows
@@ -51,6 +163,16 @@ type AdvancedScannable interface {
 	ColumnNames() ([]string, error)
 }
 
+// ColumnInfoScannable is AdvancedScannable, plus a Columns function which describes each column in
+// more detail than its name. Where it is available, it is used for type validation and conversion.
+// Implementations should compute the information once per result set. ColumnNames must agree with
+// the names returned by Columns.
+type ColumnInfoScannable interface {
+	AdvancedScannable
+
+	Columns() ([]ColumnInfo, error)
+}
+
 // IterableScannable is AdvancedScannable, plus Next and Err. With these additional methods, you can
 // iterate over the datasource, fetching values until end of input (or error) and assemble them into
 // an aggregate structure of some sort.
@@ -62,6 +184,16 @@ type IterableScannable interface {
 	Close() error
 }
 
+// VaryingColumnsScannable is IterableScannable, for sources whose rows don't all have the same
+// columns, such as those reading JSON objects. ColumnNames describes the current row (or before the
+// first call to Next, the first row), and ColumnsChanged reports whether the row Next last moved to
+// has different columns to the one before it, in which case ScanArray maps the columns again.
+type VaryingColumnsScannable interface {
+	IterableScannable
+
+	ColumnsChanged() bool
+}
+
 // scannableWrapper is a shim used to make *sql.Row universally compatible with these functions. The
 // shim expects to be used in a manner compliant with an *sql.Rows.
 type scannableWrapper struct {
@@ -99,3 +231,9 @@ func (s *scannableWrapper) ColumnNames() ([]string, error) {
 func WrapBasic(inner Scannable) IterableScannable {
 	return &scannableWrapper{Scannable: inner}
 }
+
+// Execer is implemented by *sql.DB, *sql.Tx and *sql.Conn, and is used by the insert and update
+// functions generated by dmlgen.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
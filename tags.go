@@ -0,0 +1,56 @@
+package dml
+
+import (
+	"reflect"
+	"strings"
+)
+
+// TagParser interprets the value of a struct tag with the given key, reporting false if it doesn't
+// name a column, in which case the field's next tag key (if any) is tried. See Mapper.TagKeys.
+type TagParser func(key, value string) (FieldTag, bool, error)
+
+// DefaultTagParser is the TagParser Mappers use unless they are given another. It reads `gorm`
+// tags with ParseGormTag, `db` tags with ParseSqlxTag, and any others the way `dml` tags are read
+// (see FieldTag).
+func DefaultTagParser(key, value string) (FieldTag, bool, error) {
+	switch key {
+	case "gorm":
+		return ParseGormTag(value)
+	case "db":
+		return ParseSqlxTag(value)
+	}
+	return parseTagValue(value, true)
+}
+
+// ParseSqlxTag reads a tag the way sqlx does: the column name is everything before the first comma,
+// and the rest is ignored. A name of "-" (or no name at all) doesn't name a column.
+func ParseSqlxTag(value string) (FieldTag, bool, error) {
+	name := strings.SplitN(value, ",", 2)[0]
+	if name == "" || name == "-" { return FieldTag{}, false, nil }
+	return FieldTag{Name: name}, true, nil
+}
+
+// ParseGormTag reads the column name from a gorm tag's `column:NAME` setting, as in
+// `gorm:"column:user_id;primaryKey"`. Tags without one don't name a column, since gorm would derive
+// it from the field's name, and the other settings are ignored.
+func ParseGormTag(value string) (FieldTag, bool, error) {
+	for _, setting := range strings.Split(value, ";") {
+		kv := strings.SplitN(strings.TrimSpace(setting), ":", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "column") && kv[1] != "" { return FieldTag{Name: kv[1]}, true, nil }
+	}
+	return FieldTag{}, false, nil
+}
+
+// Mapper.parseTag parses the first of m's tag keys which the field has a tag for and which names a
+// column, reporting false if there isn't one.
+func (m *Mapper) parseTag(tag reflect.StructTag) (FieldTag, bool, error) {
+	parse := m.TagParser
+	if parse == nil { parse = DefaultTagParser }
+	for _, key := range m.TagKeys {
+		value, ok := tag.Lookup(key)
+		if !ok { continue }
+		output, ok, err := parse(key, value)
+		if err != nil || ok { return output, true, err }
+	}
+	return FieldTag{}, false, nil
+}
@@ -0,0 +1,206 @@
+package dml
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TypeMismatch describes a column whose type isn't suitable for the field it maps to.
+type TypeMismatch struct {
+	Column int
+	Name   string
+	Field  reflect.Type
+	Reason string
+}
+
+// TypeMismatchError is returned by ValidateMap, and lists every mismatch it found.
+type TypeMismatchError []TypeMismatch
+
+func (e TypeMismatchError) Error() string {
+	reasons := make([]string, len(e))
+	for i, m := range e {
+		reasons[i] = fmt.Sprintf("column %d (%s) into %v: %s", m.Column, m.Name, m.Field, m.Reason)
+	}
+	return "incompatible column types: " + strings.Join(reasons, "; ")
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	bytesType    = reflect.TypeOf([]byte(nil))
+	rawBytesType = reflect.TypeOf(sql.RawBytes(nil))
+)
+
+// nullTypes maps the sql.Null* types, which drivers commonly report as the scan type of nullable
+// columns, to the types they wrap. (sql.NullByte and sql.NullInt16 are left out, as they need Go 1.17.)
+var nullTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+	reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+	reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+	reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+	reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+	reflect.TypeOf(sql.NullTime{}):    timeType,
+}
+
+// textTypes are database type names which are known to hold text, for drivers which report such
+// columns with a scan type of []byte.
+var textTypes = map[string]bool{
+	"TEXT": true, "VARCHAR": true, "CHAR": true, "BPCHAR": true, "NCHAR": true, "NVARCHAR": true,
+	"CHARACTER": true, "CHARACTER VARYING": true, "TINYTEXT": true, "MEDIUMTEXT": true, "LONGTEXT": true,
+}
+
+// typeClass buckets types into the groups between which database/sql can convert values.
+type typeClass int
+
+const (
+	classUnknown typeClass = iota
+	classInt
+	classFloat
+	classBool
+	classText
+	classBytes
+	classTime
+)
+
+func classify(t reflect.Type) typeClass {
+	switch {
+	case t == timeType:
+		return classTime
+	case t == bytesType || t == rawBytesType:
+		return classBytes
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return classInt
+	case reflect.Float32, reflect.Float64:
+		return classFloat
+	case reflect.Bool:
+		return classBool
+	case reflect.String:
+		return classText
+	}
+	return classUnknown
+}
+
+// compatible is a table of which classes of column can be scanned into which classes of field,
+// following the conversions database/sql's convertAssign performs. Text can be parsed as anything
+// in principle, but a text column holding numbers is almost always a mistake, so it is rejected.
+var compatible = map[typeClass]map[typeClass]bool{
+	classInt:   {classInt: true, classFloat: true, classBool: true, classText: true, classBytes: true},
+	classFloat: {classFloat: true, classText: true, classBytes: true},
+	classBool:  {classBool: true, classText: true, classBytes: true},
+	classText:  {classText: true, classBytes: true},
+	classBytes: {classInt: true, classFloat: true, classBool: true, classText: true, classBytes: true, classTime: true},
+	classTime:  {classTime: true, classText: true, classBytes: true},
+}
+
+// checkColumn returns a description of why a column of type c can't be scanned into field, or "".
+func checkColumn(c ColumnInfo, field interface{}) string {
+	// fields with defaults accept NULL, and are otherwise just like the field they wrap.
+	if d, ok := field.(*defaultScanner); ok {
+		c.Nullable = false
+		field = d.field
+	}
+	if _, ok := field.(sql.Scanner); ok { return "" }
+	ft := reflect.TypeOf(field)
+	if ft == nil || ft.Kind() != reflect.Ptr { return "" }
+	ft = ft.Elem()
+
+	// pointers, interfaces, and slices can all hold NULL.
+	nullable_field := false
+	switch ft.Kind() {
+	case reflect.Interface:
+		return ""
+	case reflect.Ptr:
+		nullable_field = true
+		ft = ft.Elem()
+	case reflect.Slice:
+		nullable_field = true
+	}
+	if reflect.PtrTo(ft).Implements(sqlScannerType) { return "" }
+
+	st := c.ScanType
+	nullable := c.Nullable && c.NullableKnown
+	if wrapped, ok := nullTypes[st]; ok {
+		st = wrapped
+		nullable = nullable || !c.NullableKnown
+	}
+
+	if nullable && !nullable_field { return "column is nullable but field cannot hold NULL" }
+	if st == nil { return "" }
+
+	column_class := classify(st)
+	if column_class == classBytes && textTypes[strings.ToUpper(c.DatabaseTypeName)] { column_class = classText }
+	field_class := classify(ft)
+	if column_class == classUnknown || field_class == classUnknown { return "" }
+
+	if !compatible[column_class][field_class] {
+		if c.DatabaseTypeName != "" { return fmt.Sprintf("cannot convert %s (%v) to %v", c.DatabaseTypeName, st, ft) }
+		return fmt.Sprintf("cannot convert %v to %v", st, ft)
+	}
+	return ""
+}
+
+// ValidateMap checks that each column of adv is of a type which can be scanned into the field m
+// maps it to. Every mismatch is collected and returned together as a TypeMismatchError, so that
+// problems are reported once per result set, before any rows are scanned. If adv isn't a
+// ColumnInfoScannable, there is nothing to check, and nil is returned.
+func ValidateMap(adv AdvancedScannable, m ScanMap, fields NamedFields) error {
+	cis, ok := adv.(ColumnInfoScannable)
+	if !ok { return nil }
+	columns, err := cis.Columns()
+	if err != nil { return err }
+
+	return validateColumns(columns, m, nil, fields)
+}
+
+// validateColumns checks columns against the fields m maps them to, skipping columns which conv
+// passes through a converter, since the converter decides what it accepts.
+func validateColumns(columns []ColumnInfo, m ScanMap, conv conversions, fields NamedFields) error {
+	var mismatches TypeMismatchError
+	for i, c := range columns {
+		idx := i
+		if m != nil {
+			if i >= len(m) { break }
+			idx = m[i]
+		}
+		if idx < 0 || idx >= len(fields.Fields) { continue }
+		if conv != nil && conv[i] != nil { continue }
+
+		// fields behind nil embedded pointers are checked as they will be once the pointers are allocated.
+		field := fields.Fields[idx]
+		if l, ok := field.(*lazyField); ok { field = l.placeholder() }
+		if reason := checkColumn(c, field); reason != "" {
+			mismatches = append(mismatches, TypeMismatch{Column: i, Name: c.Name, Field: reflect.TypeOf(unwrapField(field)).Elem(), Reason: reason})
+		}
+	}
+
+	if len(mismatches) != 0 { return mismatches }
+	return nil
+}
+
+// Mapper.buildMap builds a ScanMap with BuildMap, chooses converters for its columns from
+// mapper's converters (or to parse arrays, for columns which are known to hold them), and then
+// validates it with ValidateMap if m validates types.
+func (mapper *Mapper) buildMap(adv AdvancedScannable, fields NamedFields) (ScanMap, conversions, error) {
+	m, err := mapper.BuildMap(adv, fields)
+	if err != nil { return nil, nil, err }
+	var conv conversions
+	if c := mapper.Converters; c != nil {
+		conv, err = c.buildConversions(adv, m, fields)
+		if err != nil { return nil, nil, err }
+	}
+	conv, err = detectArrays(adv, m, fields, conv)
+	if err != nil || !mapper.ValidateTypes { return m, conv, err }
+
+	cis, ok := adv.(ColumnInfoScannable)
+	if !ok { return m, conv, nil }
+	columns, err := cis.Columns()
+	if err != nil { return nil, nil, err }
+	if err = validateColumns(columns, m, conv, fields); err != nil { return nil, nil, err }
+	return m, conv, nil
+}